@@ -2,11 +2,14 @@ package client
 
 import (
 	"context"
+	"time"
 
 	"github.com/bww/go-tasks/v1"
 	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
 
 	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-ident/v1"
 )
 
 var jsonContentType = api.WithHeader("Content-Type", "application/json")
@@ -33,20 +36,119 @@ func (c *Client) Submit(cxt context.Context, msg *transport.Message, opts ...tas
 	}
 }
 
+// Execute submits a task to the service to be executed synchronously; see
+// ExecuteResult, which also produces the result of the task.
 func (c *Client) Execute(cxt context.Context, msg *transport.Message, opts ...tasks.PublishOption) error {
+	_, err := c.ExecuteResult(cxt, msg, opts...)
+	return err
+}
+
+// ExecuteResult submits a task to the service to be executed synchronously
+// and returns the result it produced. If the task could not be executed
+// because of a known condition, such as an unsupported UTD, the corresponding
+// typed error is returned; e.g., [tasks.ErrUnsupported].
+func (c *Client) ExecuteResult(cxt context.Context, msg *transport.Message, opts ...tasks.PublishOption) (tasks.Result, error) {
 	conf := tasks.PublishConfig{}.WithOptions(opts)
-	_, err := c.Post(cxt, "v1/tasks"+conf.Query(), msg, nil, jsonContentType)
+	msg.SetTraceContext(cxt) // the service continues the caller's trace
+	var res tasks.Result
+	_, err := c.Post(cxt, "v1/tasks"+conf.Query(), msg, &res, jsonContentType)
 	if err != nil {
-		return err
+		return tasks.Result{}, mapError(err)
 	}
-	return nil
+	return res, nil
 }
 
+// Publish enqueues a task. As with [tasks.Queue.Publish], the message's Id is
+// updated to reflect the identifier it was assigned; see PublishIdent.
 func (c *Client) Publish(cxt context.Context, msg *transport.Message, opts ...tasks.PublishOption) error {
+	_, err := c.PublishIdent(cxt, msg, opts...)
+	return err
+}
+
+// PublishIdent enqueues a task and returns the identifier it was assigned.
+// As with Publish, the message's Id is updated to reflect it.
+func (c *Client) PublishIdent(cxt context.Context, msg *transport.Message, opts ...tasks.PublishOption) (ident.Ident, error) {
 	conf := tasks.PublishConfig{}.WithOptions(opts)
-	_, err := c.Post(cxt, "v1/queue"+conf.Query(), msg, nil, jsonContentType)
+	msg.SetTraceContext(cxt) // the service continues the caller's trace
+	var res transport.Message
+	_, err := c.Post(cxt, "v1/queue"+conf.Query(), msg, &res, jsonContentType)
+	if err != nil {
+		return ident.Zero, mapError(err)
+	}
+	msg.Id = res.Id
+	return res.Id, nil
+}
+
+// PublishWorkflow submits a workflow of dependent tasks. As with Publish, the
+// workflow is updated to reflect the identifiers assigned to it and its
+// steps, and the workflow identifier is returned.
+func (c *Client) PublishWorkflow(cxt context.Context, wf *worklog.Workflow, opts ...tasks.PublishOption) (ident.Ident, error) {
+	conf := tasks.PublishConfig{}.WithOptions(opts)
+	var res worklog.Workflow
+	_, err := c.Post(cxt, "v1/workflows"+conf.Query(), wf, &res, jsonContentType)
+	if err != nil {
+		return ident.Zero, mapError(err)
+	}
+	*wf = res
+	return res.Id, nil
+}
+
+// Status fetches the latest worklog entry for a managed task.
+func (c *Client) Status(cxt context.Context, id ident.Ident) (*worklog.Entry, error) {
+	var ent *worklog.Entry
+	_, err := c.Get(cxt, "v1/tasks/"+id.String(), &ent)
 	if err != nil {
-		return err
+		return nil, mapError(err)
+	}
+	return ent, nil
+}
+
+// History fetches every worklog entry for a managed task, in sequence order.
+func (c *Client) History(cxt context.Context, id ident.Ident) ([]*worklog.Entry, error) {
+	var res struct {
+		Entries []*worklog.Entry `json:"entries"`
+	}
+	_, err := c.Get(cxt, "v1/tasks/"+id.String()+"/history", &res)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return res.Entries, nil
+}
+
+// Wait polls the status of a managed task until it is resolved and returns
+// its final entry. The entry describes the outcome of the task: its UTD and
+// Data are the result produced by the task, and if the task did not complete
+// successfully its Error describes why.
+//
+// Wait returns an error if the context ends or the timeout elapses before the
+// task is resolved.
+func (c *Client) Wait(cxt context.Context, id ident.Ident, opts ...WaitOption) (*worklog.Entry, error) {
+	conf := WaitConfig{
+		Interval: defaultPollInterval,
+	}.WithOptions(opts)
+	if conf.Interval <= 0 {
+		conf.Interval = defaultPollInterval
+	}
+
+	if conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		cxt, cancel = context.WithTimeout(cxt, conf.Timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+	for {
+		ent, err := c.Status(cxt, id)
+		if err != nil {
+			return nil, err
+		} else if ent.Resolved() {
+			return ent, nil
+		}
+		select {
+		case <-cxt.Done():
+			return nil, cxt.Err()
+		case <-ticker.C:
+		}
 	}
-	return nil
 }
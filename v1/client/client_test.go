@@ -0,0 +1,253 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	api "github.com/bww/go-apiclient/v1"
+	"github.com/bww/go-ident/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// request records a request received by a test service
+type request struct {
+	Method, Path, Query string
+	Entity              []byte
+}
+
+// newTestClient produces a client for a test service which records every
+// request it receives and responds with the handler
+func newTestClient(t *testing.T, sync bool, h http.HandlerFunc) (*Client, *[]request) {
+	var reqs []request
+	srv := httptest.NewServer(http.HandlerFunc(func(rsp http.ResponseWriter, req *http.Request) {
+		data, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		reqs = append(reqs, request{Method: req.Method, Path: req.URL.Path, Query: req.URL.RawQuery, Entity: data})
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		h(rsp, req)
+	}))
+	t.Cleanup(srv.Close)
+	c, err := api.New(srv.URL + "/")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return NewWithConfig(Config{Client: c, Sync: sync}), &reqs
+}
+
+// respond writes a JSON entity with the provided status
+func respond(rsp http.ResponseWriter, status int, entity any) {
+	rsp.Header().Set("Content-Type", "application/json")
+	rsp.WriteHeader(status)
+	json.NewEncoder(rsp).Encode(entity)
+}
+
+func TestExecute(t *testing.T) {
+	cxt := context.Background()
+	c, reqs := newTestClient(t, true, func(rsp http.ResponseWriter, req *http.Request) {
+		respond(rsp, http.StatusOK, tasks.Result{UTD: "test://result", State: []byte("result")})
+	})
+
+	msg := transport.New("test://execute")
+	msg.Data = []byte("data")
+	res, err := c.ExecuteResult(cxt, msg, tasks.WithIdempotencyKey("abc"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test://result", res.UTD)
+		assert.Equal(t, []byte("result"), res.State)
+	}
+	if assert.Len(t, *reqs, 1) {
+		r := (*reqs)[0]
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/tasks", r.Path)
+		assert.Equal(t, "idempotency_key=abc", r.Query)
+		var sent transport.Message
+		if assert.NoError(t, json.Unmarshal(r.Entity, &sent)) {
+			assert.Equal(t, "test://execute", sent.UTD)
+			assert.Equal(t, []byte("data"), sent.Data)
+		}
+	}
+
+	// a synchronous client executes tasks it is submitted
+	err = c.Submit(cxt, transport.New("test://execute"))
+	assert.NoError(t, err)
+	if assert.Len(t, *reqs, 2) {
+		assert.Equal(t, "/v1/tasks", (*reqs)[1].Path)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	cxt := context.Background()
+	id := ident.New()
+	c, reqs := newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		var msg transport.Message
+		json.NewDecoder(req.Body).Decode(&msg)
+		msg.Id = id
+		respond(rsp, http.StatusOK, msg)
+	})
+
+	msg := transport.New("test://publish")
+	res, err := c.PublishIdent(cxt, msg)
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, res)
+		assert.Equal(t, id, msg.Id)
+	}
+
+	// an asynchronous client enqueues tasks it is submitted
+	msg = transport.New("test://publish")
+	err = c.Submit(cxt, msg)
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, msg.Id)
+	}
+	if assert.Len(t, *reqs, 2) {
+		for _, r := range *reqs {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/v1/queue", r.Path)
+		}
+	}
+}
+
+func TestPublishWorkflow(t *testing.T) {
+	cxt := context.Background()
+	wid, sid := ident.New(), ident.New()
+	c, reqs := newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		var wf worklog.Workflow
+		json.NewDecoder(req.Body).Decode(&wf)
+		wf.Id = wid
+		for k, e := range wf.Steps {
+			e.TaskId = sid
+			wf.Steps[k] = e
+		}
+		respond(rsp, http.StatusOK, wf)
+	})
+
+	wf := worklog.NewWorkflow().AddStep("a", "test://a", nil)
+	res, err := c.PublishWorkflow(cxt, wf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, wid, res)
+		assert.Equal(t, wid, wf.Id)
+		if assert.Len(t, wf.Steps, 1) {
+			assert.Equal(t, "test://a", wf.Steps["a"].UTD)
+			assert.Equal(t, sid, wf.Steps["a"].TaskId)
+		}
+	}
+	if assert.Len(t, *reqs, 1) {
+		assert.Equal(t, http.MethodPost, (*reqs)[0].Method)
+		assert.Equal(t, "/v1/workflows", (*reqs)[0].Path)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	cxt := context.Background()
+	id := ident.New()
+	c, reqs := newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/tasks/"+id.String() {
+			respond(rsp, http.StatusOK, &worklog.Entry{TaskId: id, TaskSeq: 2, State: worklog.Running, UTD: "test://status"})
+		} else {
+			respond(rsp, http.StatusNotFound, map[string]string{"message": "No such task"})
+		}
+	})
+
+	ent, err := c.Status(cxt, id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, ent.TaskId)
+		assert.Equal(t, int64(2), ent.TaskSeq)
+		assert.Equal(t, worklog.Running, ent.State)
+		assert.Equal(t, "test://status", ent.UTD)
+	}
+	if assert.Len(t, *reqs, 1) {
+		assert.Equal(t, http.MethodGet, (*reqs)[0].Method)
+	}
+
+	_, err = c.Status(cxt, ident.New())
+	assert.Error(t, err)
+}
+
+func TestHistory(t *testing.T) {
+	cxt := context.Background()
+	id := ident.New()
+	c, reqs := newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		respond(rsp, http.StatusOK, map[string]any{"entries": []*worklog.Entry{
+			{TaskId: id, TaskSeq: 1, State: worklog.Pending},
+			{TaskId: id, TaskSeq: 2, State: worklog.Running},
+			{TaskId: id, TaskSeq: 3, State: worklog.Complete},
+		}})
+	})
+
+	res, err := c.History(cxt, id)
+	if assert.NoError(t, err) && assert.Len(t, res, 3) {
+		for i, e := range []worklog.State{worklog.Pending, worklog.Running, worklog.Complete} {
+			assert.Equal(t, id, res[i].TaskId)
+			assert.Equal(t, int64(i+1), res[i].TaskSeq)
+			assert.Equal(t, e, res[i].State)
+		}
+	}
+	if assert.Len(t, *reqs, 1) {
+		assert.Equal(t, http.MethodGet, (*reqs)[0].Method)
+		assert.Equal(t, "/v1/tasks/"+id.String()+"/history", (*reqs)[0].Path)
+	}
+}
+
+func TestWait(t *testing.T) {
+	cxt := context.Background()
+	id := ident.New()
+
+	// the task is resolved after it has been polled a few times
+	var polled int
+	c, reqs := newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		polled++
+		if polled < 3 {
+			respond(rsp, http.StatusOK, &worklog.Entry{TaskId: id, TaskSeq: int64(polled), State: worklog.Running})
+		} else {
+			respond(rsp, http.StatusOK, &worklog.Entry{TaskId: id, TaskSeq: int64(polled), State: worklog.Failed, Error: []byte(`{"message":"Oops"}`)})
+		}
+	})
+	ent, err := c.Wait(cxt, id, WithPollInterval(time.Millisecond))
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Failed, ent.State)
+		assert.JSONEq(t, `{"message":"Oops"}`, string(ent.Error))
+	}
+	if assert.Len(t, *reqs, 3) {
+		for _, r := range *reqs {
+			assert.Equal(t, "/v1/tasks/"+id.String(), r.Path)
+		}
+	}
+
+	// the task is never resolved
+	c, _ = newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		respond(rsp, http.StatusOK, &worklog.Entry{TaskId: id, TaskSeq: 1, State: worklog.Pending})
+	})
+	_, err = c.Wait(cxt, id, WithPollInterval(time.Millisecond), WithTimeout(time.Millisecond*50))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the task cannot be found
+	c, _ = newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		respond(rsp, http.StatusNotFound, map[string]string{"message": "No such task"})
+	})
+	_, err = c.Wait(cxt, id, WithPollInterval(time.Millisecond))
+	assert.Error(t, err)
+}
+
+func TestWaitInterval(t *testing.T) {
+	cxt := context.Background()
+	id := ident.New()
+	c, _ := newTestClient(t, false, func(rsp http.ResponseWriter, req *http.Request) {
+		respond(rsp, http.StatusOK, &worklog.Entry{TaskId: id, TaskSeq: 1, State: worklog.Complete})
+	})
+
+	// an interval which is not positive falls back to the default
+	for _, d := range []time.Duration{0, -time.Second} {
+		ent, err := c.Wait(cxt, id, WithPollInterval(d))
+		if assert.NoError(t, err, "%v", d) {
+			assert.Equal(t, worklog.Complete, ent.State)
+		}
+	}
+}
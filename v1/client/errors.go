@@ -0,0 +1,35 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/bww/go-tasks/v1"
+)
+
+// entityError is implemented by API client errors which retain the entity of
+// the response that produced them.
+type entityError interface {
+	error
+	Entity() []byte
+}
+
+// serviceError is the subset of an error reported by the service which is
+// needed to identify it.
+type serviceError struct {
+	Code string `json:"code"`
+}
+
+// mapError converts an error reported by the service back into the typed
+// error it represents, if any; otherwise the error is returned as-is.
+func mapError(err error) error {
+	var eerr entityError
+	if !errors.As(err, &eerr) {
+		return err
+	}
+	var serr serviceError
+	if json.Unmarshal(eerr.Entity(), &serr) != nil || serr.Code == "" {
+		return err
+	}
+	return tasks.ErrorForCode(serr.Code, err)
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/transport"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		Status int
+		Entity any
+		Expect error
+		Check  func(error) bool
+	}{
+		{
+			Status: http.StatusBadGateway,
+			Entity: map[string]string{"message": "No route", "code": tasks.CodeUnsupported},
+			Expect: tasks.ErrUnsupported,
+		},
+		{
+			Status: http.StatusBadRequest,
+			Entity: map[string]string{"message": "Invalid parameters", "code": tasks.CodeInvalidParameters},
+			Expect: tasks.ErrInvalidParameters,
+		},
+		{
+			Status: http.StatusBadGateway,
+			Entity: map[string]string{"message": "Try again", "code": tasks.CodeRecoverable},
+			Check:  tasks.IsRecoverable,
+		},
+		{
+			Status: http.StatusBadGateway,
+			Entity: map[string]string{"message": "Who knows", "code": "unknown"},
+		},
+		{
+			Status: http.StatusInternalServerError,
+			Entity: "Not even JSON",
+		},
+	}
+	for _, e := range tests {
+		c, _ := newTestClient(t, true, func(rsp http.ResponseWriter, req *http.Request) {
+			respond(rsp, e.Status, e.Entity)
+		})
+		_, err := c.ExecuteResult(context.Background(), transport.New("test://error"))
+		if !assert.Error(t, err, "%v", e.Entity) {
+			continue
+		}
+		if e.Expect != nil {
+			assert.ErrorIs(t, err, e.Expect, "%v", e.Entity)
+		}
+		if e.Check != nil {
+			assert.True(t, e.Check(err), "%v", e.Entity)
+		}
+		if e.Expect == nil && e.Check == nil { // not mapped
+			for _, x := range []error{tasks.ErrUnsupported, tasks.ErrMalformed, tasks.ErrInvalidParameters, tasks.ErrInvalidRequest} {
+				assert.NotErrorIs(t, err, x, "%v", e.Entity)
+			}
+			assert.False(t, tasks.IsRecoverable(err), "%v", e.Entity)
+		}
+	}
+
+	// errors which do not carry a response entity are returned as-is
+	err := errors.New("Connection refused")
+	assert.Equal(t, err, mapError(err))
+}
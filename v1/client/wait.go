@@ -0,0 +1,35 @@
+package client
+
+import (
+	"time"
+)
+
+const defaultPollInterval = time.Second
+
+type WaitConfig struct {
+	Interval time.Duration // the interval at which the task status is polled; the default is used if this is not positive
+	Timeout  time.Duration // the maximum duration to wait; zero waits until the context ends
+}
+
+func (c WaitConfig) WithOptions(opts []WaitOption) WaitConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type WaitOption func(WaitConfig) WaitConfig
+
+func WithPollInterval(d time.Duration) WaitOption {
+	return func(c WaitConfig) WaitConfig {
+		c.Interval = d
+		return c
+	}
+}
+
+func WithTimeout(d time.Duration) WaitOption {
+	return func(c WaitConfig) WaitConfig {
+		c.Timeout = d
+		return c
+	}
+}
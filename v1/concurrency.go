@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"time"
+
+	"github.com/bww/go-tasks/v1/utds"
+)
+
+const defaultConcurrencyDelay = time.Second * 5
+
+// ConcurrencyMode describes how a task which would exceed the concurrency
+// limit for its key is handled
+type ConcurrencyMode string
+
+const (
+	Defer    = ConcurrencyMode("defer")    // the task is held and attempted again once the delay has elapsed
+	Coalesce = ConcurrencyMode("coalesce") // the task is discarded in favor of those already running and is resolved as Canceled
+)
+
+// ConcurrencyPolicy limits the number of managed tasks which share a key that
+// may run at once across the cluster. Tasks are coordinated through the
+// worklog, so the policy has no effect on tasks which are not managed. The
+// zero value is unlimited.
+type ConcurrencyPolicy struct {
+	Limit int                     // the maximum number of tasks with the same key which may run at once; zero is unlimited
+	Mode  ConcurrencyMode         // how tasks which exceed the limit are handled; defaults to Defer
+	Delay time.Duration           // the delay before a deferred task is attempted again; defaults to five seconds
+	Key   func(utd string) string // derives the key from a UTD; defaults to utds.Identity
+}
+
+// Limited determines if the policy imposes a limit at all
+func (p ConcurrencyPolicy) Limited() bool {
+	return p.Limit > 0
+}
+
+// KeyFor produces the concurrency key for the provided UTD
+func (p ConcurrencyPolicy) KeyFor(utd string) string {
+	if p.Key != nil {
+		return p.Key(utd)
+	} else {
+		return utds.Identity(utd)
+	}
+}
+
+// Backoff produces the delay before a deferred task is attempted again
+func (p ConcurrencyPolicy) Backoff() time.Duration {
+	if p.Delay > 0 {
+		return p.Delay
+	} else {
+		return defaultConcurrencyDelay
+	}
+}
@@ -3,10 +3,14 @@ package tasks
 import (
 	"net/url"
 	"strconv"
+	"time"
 )
 
 type PublishConfig struct {
-	StateSeq int64
+	StateSeq  int64
+	NotBefore time.Time // the task is not run before this time, if set
+	ExpiresAt time.Time // the task is discarded if it has not run by this time, if set
+	Key       string    // the idempotency key which identifies duplicate submissions, if set
 }
 
 func PublishConfigFromParams(params url.Values) (PublishConfig, error) {
@@ -18,6 +22,35 @@ func PublishConfigFromParams(params url.Values) (PublishConfig, error) {
 		}
 		c.StateSeq = x
 	}
+	if v := params.Get("not_before"); v != "" {
+		x, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return c, err
+		}
+		c.NotBefore = x
+	}
+	if v := params.Get("delay"); v != "" {
+		x, err := time.ParseDuration(v)
+		if err != nil {
+			return c, err
+		}
+		c.NotBefore = time.Now().Add(x)
+	}
+	if v := params.Get("expires_at"); v != "" {
+		x, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return c, err
+		}
+		c.ExpiresAt = x
+	}
+	if v := params.Get("ttl"); v != "" {
+		x, err := time.ParseDuration(v)
+		if err != nil {
+			return c, err
+		}
+		c.ExpiresAt = time.Now().Add(x)
+	}
+	c.Key = params.Get("idempotency_key")
 	return c, nil
 }
 
@@ -33,6 +66,15 @@ func (c PublishConfig) Params() url.Values {
 	if c.StateSeq != 0 {
 		params.Set("state_seq", strconv.FormatInt(c.StateSeq, 10))
 	}
+	if !c.NotBefore.IsZero() {
+		params.Set("not_before", c.NotBefore.Format(time.RFC3339Nano))
+	}
+	if !c.ExpiresAt.IsZero() {
+		params.Set("expires_at", c.ExpiresAt.Format(time.RFC3339Nano))
+	}
+	if c.Key != "" {
+		params.Set("idempotency_key", c.Key)
+	}
 	return params
 }
 
@@ -59,3 +101,44 @@ func WithStateSeq(seq int64) PublishOption {
 		return c
 	}
 }
+
+// WithRunAt defers a task so that it is not run before the provided time.
+func WithRunAt(t time.Time) PublishOption {
+	return func(c PublishConfig) PublishConfig {
+		c.NotBefore = t
+		return c
+	}
+}
+
+// WithDelay defers a task so that it is not run until the provided duration
+// has elapsed.
+func WithDelay(d time.Duration) PublishOption {
+	return WithRunAt(time.Now().Add(d))
+}
+
+// WithExpiresAt discards a task if it has not run by the provided time. A
+// managed task which is discarded is resolved as worklog.Lapsed.
+func WithExpiresAt(t time.Time) PublishOption {
+	return func(c PublishConfig) PublishConfig {
+		c.ExpiresAt = t
+		return c
+	}
+}
+
+// WithTTL discards a task if it has not run before the provided duration
+// has elapsed.
+func WithTTL(d time.Duration) PublishOption {
+	return WithExpiresAt(time.Now().Add(d))
+}
+
+// WithIdempotencyKey suppresses duplicate submissions of a managed task: if
+// a task published with the same key is still pending or running, nothing
+// is published and the message assumes that task's identifier. A stable key
+// for the identity of a UTD is produced by
+// [github.com/bww/go-tasks/v1/utds.Key].
+func WithIdempotencyKey(k string) PublishOption {
+	return func(c PublishConfig) PublishConfig {
+		c.Key = k
+		return c
+	}
+}
@@ -0,0 +1,28 @@
+package tasks
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishConfigParams(t *testing.T) {
+	now := time.Now()
+	conf := PublishConfig{}.WithOptions([]PublishOption{WithStateSeq(2), WithRunAt(now), WithTTL(time.Hour), WithIdempotencyKey("abc")})
+	res, err := PublishConfigFromParams(conf.Params())
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), res.StateSeq)
+		assert.True(t, now.Equal(res.NotBefore))
+		assert.True(t, conf.ExpiresAt.Equal(res.ExpiresAt))
+		assert.Equal(t, "abc", res.Key)
+	}
+
+	res, err = PublishConfigFromParams(url.Values{"delay": {"15m"}})
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now().Add(time.Minute*15), res.NotBefore, time.Second)
+	}
+	_, err = PublishConfigFromParams(url.Values{"delay": {"soon"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+// Package deadletter provides a dead-letter queue for task messages which
+// cannot be processed: messages which cannot be parsed and tasks which have
+// failed definitively. A dead letter carries the raw message that was
+// received along with metadata describing the failure, so that it can be
+// inspected and, once the underlying problem is addressed, redriven back
+// onto the main queue.
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-queue/v1"
+)
+
+const (
+	attrReason       = "dl_reason"
+	attrError        = "dl_error"
+	attrNode         = "dl_node"
+	attrSubscription = "dl_subscription"
+	attrTime         = "dl_time"
+)
+
+var metaAttrs = []string{
+	attrReason,
+	attrError,
+	attrNode,
+	attrSubscription,
+	attrTime,
+}
+
+type Reason string
+
+const (
+	Malformed = Reason("malformed") // the message could not be parsed
+	Failed    = Reason("failed")    // the task failed definitively, after exhausting any retries
+)
+
+// Metadata describes why a message was dead-lettered
+type Metadata struct {
+	Reason       Reason
+	Error        string
+	Node         string
+	Subscription string
+	Time         time.Time
+}
+
+// Publish sends a raw message to the dead-letter queue along with metadata
+// describing the failure.
+func Publish(dlq queue.Queue, raw *queue.Message, meta Metadata) error {
+	attrs := make(queue.Attributes)
+	maps.Copy(attrs, raw.Attributes)
+	attrs[attrReason] = string(meta.Reason)
+	attrs[attrError] = meta.Error
+	attrs[attrNode] = meta.Node
+	attrs[attrSubscription] = meta.Subscription
+	attrs[attrTime] = meta.Time.UTC().Format(time.RFC3339Nano)
+	return dlq.Publish(&queue.Message{
+		Attributes: attrs,
+		Data:       raw.Data,
+	})
+}
+
+// Letter is a message received from the dead-letter queue. The letter must
+// be either acknowledged, which discards it, negatively acknowledged, which
+// returns it to the dead-letter queue, or redriven.
+type Letter struct {
+	Metadata
+	Message *queue.Message // the raw message as it was originally received
+	d       queue.Delivery
+}
+
+func (l Letter) Ack() {
+	if l.d != nil {
+		l.d.Ack()
+	}
+}
+
+func (l Letter) Nack() {
+	if l.d != nil {
+		l.d.Nack()
+	}
+}
+
+// Task attempts to parse the original message as a task; this fails for
+// letters which were dead-lettered because they were malformed.
+func (l Letter) Task() (*transport.Message, error) {
+	return transport.Parse(l.Message)
+}
+
+func (l Letter) String() string {
+	return fmt.Sprintf("<%s %s: %s>", l.Reason, l.Time.Format(time.RFC3339), l.Error)
+}
+
+func newLetter(d queue.Delivery) Letter {
+	m := d.Message()
+	attrs := maps.Clone(m.Attributes)
+	t, _ := time.Parse(time.RFC3339Nano, attrs[attrTime]) // a malformed time is left zero
+	l := Letter{
+		Metadata: Metadata{
+			Reason:       Reason(attrs[attrReason]),
+			Error:        attrs[attrError],
+			Node:         attrs[attrNode],
+			Subscription: attrs[attrSubscription],
+			Time:         t,
+		},
+		d: d,
+	}
+	for _, e := range metaAttrs {
+		delete(attrs, e)
+	}
+	l.Message = &queue.Message{
+		Attributes: attrs,
+		Data:       m.Data,
+	}
+	return l
+}
+
+// Consume receives letters from the dead-letter queue until the context is
+// canceled or the queue is closed.
+func Consume(cxt context.Context, dlq queue.Queue, name string) (<-chan Letter, error) {
+	c, err := dlq.Consumer(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := make(chan Letter, 10)
+	go func() {
+		defer func() { close(r); c.Close() }()
+		for {
+			select {
+			case <-cxt.Done():
+				return
+			default:
+				// continue
+			}
+			d, err := c.ReceiveWithTimeout(time.Second * 10)
+			if err == queue.ErrTimeout {
+				continue // we do this to catch cancellation after a reasonable period of time
+			} else if err != nil {
+				return
+			}
+			select {
+			case r <- newLetter(d):
+			case <-cxt.Done():
+				d.Nack()
+				return
+			}
+		}
+	}()
+
+	return r, nil
+}
+
+// Redrive publishes a letter's original message back onto the main queue and
+// acknowledges it, removing it from the dead-letter queue. If the original
+// message is a task, its retry and recovery counts are reset so that it is
+// afforded a full set of attempts.
+func Redrive(target queue.Queue, l Letter) error {
+	m := l.Message
+	if msg, err := l.Task(); err == nil {
+		_, retried := msg.Attrs[worklog.AttrRetries]
+		_, recovered := msg.Attrs[worklog.AttrRecovered]
+		if retried || recovered {
+			delete(msg.Attrs, worklog.AttrRetries)
+			delete(msg.Attrs, worklog.AttrRecovered)
+			m, err = msg.Encode()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := target.Publish(m)
+	if err != nil {
+		return fmt.Errorf("Could not redrive letter: %w", err)
+	}
+	l.Ack()
+	return nil
+}
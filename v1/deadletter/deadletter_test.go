@@ -0,0 +1,103 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-queue/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedrive(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now().Truncate(time.Second)
+	dlq, main := queuetest.New(), queuetest.New()
+
+	msg := transport.New("test://task").SetAttr(worklog.AttrRetries, "3").SetAttr("other", "value")
+	raw, err := msg.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, Publish(dlq, raw, Metadata{
+		Reason:       Failed,
+		Error:        errors.New("Oops").Error(),
+		Node:         "node-1",
+		Subscription: "tasks",
+		Time:         now,
+	}))
+	assert.NoError(t, Publish(dlq, &queue.Message{Data: []byte("Garbage")}, Metadata{Reason: Malformed, Time: now}))
+
+	letters, err := Consume(cxt, dlq, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	l := <-letters
+	assert.Equal(t, Failed, l.Reason)
+	assert.Equal(t, "Oops", l.Error)
+	assert.Equal(t, "node-1", l.Node)
+	assert.Equal(t, "tasks", l.Subscription)
+	assert.True(t, now.Equal(l.Time))
+	assert.Equal(t, raw.Attributes, l.Message.Attributes) // metadata is stripped from the original
+	assert.NoError(t, Redrive(main, l))
+
+	l = <-letters
+	assert.Equal(t, Malformed, l.Reason)
+	_, err = l.Task()
+	assert.Error(t, err)
+	assert.NoError(t, Redrive(main, l))
+
+	if assert.Len(t, main.Published(), 2) {
+		red, err := transport.Parse(main.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, msg.Id, red.Id)
+			assert.Equal(t, "value", red.Attrs["other"])
+			_, ok := red.Attrs[worklog.AttrRetries] // retries are reset
+			assert.False(t, ok)
+		}
+		assert.Equal(t, "Garbage", string(main.Published()[1].Data))
+	}
+}
+
+func TestRedriveRecovered(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dlq, main := queuetest.New(), queuetest.New()
+
+	// a task the reaper failed after it exhausted its recoveries
+	msg := transport.New("test://task").SetAttr(worklog.AttrRecovered, "3").SetAttr(worklog.AttrRetries, "1")
+	raw, err := msg.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, Publish(dlq, raw, Metadata{
+		Reason: Failed,
+		Error:  "Task lease expired after 2 recoveries",
+		Node:   "node-1",
+		Time:   time.Now(),
+	}))
+
+	letters, err := Consume(cxt, dlq, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, Redrive(main, <-letters))
+
+	if assert.Len(t, main.Published(), 1) {
+		red, err := transport.Parse(main.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, msg.Id, red.Id)
+			_, ok := red.Attrs[worklog.AttrRecovered] // recoveries are reset
+			assert.False(t, ok)
+			_, ok = red.Attrs[worklog.AttrRetries]
+			assert.False(t, ok)
+		}
+	}
+}
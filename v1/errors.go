@@ -3,6 +3,8 @@ package tasks
 import (
 	"errors"
 	"fmt"
+
+	errutil "github.com/bww/go-util/v1/errors"
 )
 
 var (
@@ -10,8 +12,72 @@ var (
 	ErrMalformed         = errors.New("Malformed task UTD")
 	ErrInvalidParameters = errors.New("Invalid parameters")
 	ErrInvalidRequest    = errors.New("Invalid request")
+	ErrNoWorklog         = errors.New("Worklog is not available")
+)
+
+// Error codes identify the errors above when they are reported by the task
+// service, so that clients may map them back to the same typed errors.
+const (
+	CodeUnsupported       = "unsupported"
+	CodeMalformed         = "malformed"
+	CodeInvalidParameters = "invalid_parameters"
+	CodeInvalidRequest    = "invalid_request"
+	CodeRecoverable       = "recoverable"
 )
 
+var codes = []struct {
+	code string
+	err  error
+}{
+	{CodeUnsupported, ErrUnsupported},
+	{CodeMalformed, ErrMalformed},
+	{CodeInvalidParameters, ErrInvalidParameters},
+	{CodeInvalidRequest, ErrInvalidRequest},
+}
+
+// ErrorCode produces the code which identifies the provided error, or the
+// empty string if the error is not one which has a code.
+func ErrorCode(err error) string {
+	for _, e := range codes {
+		if errors.Is(err, e.err) {
+			return e.code
+		}
+	}
+	if IsRecoverable(err) {
+		return CodeRecoverable
+	}
+	return ""
+}
+
+// ErrorForCode is the inverse of ErrorCode; it wraps the provided cause in
+// the typed error identified by a code. If the code is not recognized the
+// cause is returned as-is.
+func ErrorForCode(code string, cause error) error {
+	if code == CodeRecoverable {
+		return NewRecoverable(cause)
+	}
+	for _, e := range codes {
+		if e.code == code {
+			return &codedError{e.err, cause}
+		}
+	}
+	return cause
+}
+
+// codedError matches a typed error but reports the message of its cause,
+// which is usually more specific
+type codedError struct {
+	err, cause error
+}
+
+func (e *codedError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *codedError) Unwrap() []error {
+	return []error{e.err, e.cause}
+}
+
 func NewServiceUnavailableError(f string) error {
 	return NewRecoverable(errors.New(f))
 }
@@ -35,3 +101,21 @@ func (e *Recoverable) Error() string {
 		return fmt.Sprintf("%s (recoverable)", e.Cause.Error())
 	}
 }
+
+// Recoverable conforms to the Recovery interface understood by
+// [github.com/bww/go-util/v1/errors.Recoverable]
+func (e *Recoverable) Recoverable() bool {
+	return true
+}
+
+// IsRecoverable determines if any error in the provided error's chain
+// describes itself as recoverable. Recoverable errors produced by a task
+// handler may be retried.
+func IsRecoverable(err error) bool {
+	var rec errutil.Recovery
+	if errors.As(err, &rec) {
+		return rec.Recoverable()
+	} else {
+		return false
+	}
+}
@@ -0,0 +1,34 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{ErrUnsupported, CodeUnsupported},
+		{fmt.Errorf("Could not route: %w", ErrMalformed), CodeMalformed},
+		{ErrInvalidParameters, CodeInvalidParameters},
+		{ErrInvalidRequest, CodeInvalidRequest},
+		{NewRecoverable(errors.New("Try again")), CodeRecoverable},
+		{errors.New("Something else"), ""},
+	}
+	for _, e := range tests {
+		assert.Equal(t, e.code, ErrorCode(e.err), e.err.Error())
+	}
+
+	cause := errors.New("Remote says no")
+	err := ErrorForCode(CodeUnsupported, cause)
+	assert.ErrorIs(t, err, ErrUnsupported)
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, cause.Error(), err.Error())
+	assert.True(t, IsRecoverable(ErrorForCode(CodeRecoverable, cause)))
+	assert.Equal(t, cause, ErrorForCode("", cause))
+}
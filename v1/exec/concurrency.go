@@ -0,0 +1,111 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// concurrencyPolicy obtains the concurrency policy for a message from the
+// route which handles it, if that route defines one which imposes a limit
+func (w *Executor) concurrencyPolicy(msg *transport.Message) (tasks.ConcurrencyPolicy, bool) {
+	if u, err := url.Parse(msg.UTD); err == nil {
+		if r, _, err := w.Router.Find(u); err == nil && r != nil {
+			if p, ok := r.ConcurrencyPolicy(); ok && p.Limited() {
+				return p, true
+			}
+		}
+	}
+	return tasks.ConcurrencyPolicy{}, false
+}
+
+// admit determines if a task which has just been recorded as running may
+// proceed under its concurrency policy. Every running task with the same key
+// is ordered by the time its running entry was created, and the task may
+// proceed only if fewer than the limit are ahead of it.
+//
+// This ordering is not the order in which the entries were stored. An entry
+// is stamped immediately before it is stored, but a task stamped earlier may
+// still be stored later than another, and a task admitted before the other
+// was stored will then be counted behind it. Both proceed and the limit is
+// exceeded, even on a single node. The window in which this can happen is the
+// time it takes to store a running entry, widened by any disagreement between
+// the clocks of the nodes in the cluster, so the limit should be considered
+// approximate for tasks which start at nearly the same time.
+func (w *Executor) admit(cxt context.Context, ent *worklog.Entry, p tasks.ConcurrencyPolicy, now time.Time) (bool, error) {
+	it, err := w.worklog.IterLatestEntryForEveryTask(cxt, worklog.Criteria{
+		ConcurrencyKey: ent.ConcurrencyKey(),
+		States:         []worklog.State{worklog.Running},
+	}, now)
+	if err != nil {
+		return false, err
+	}
+	defer it.Close()
+
+	var ahead int
+	for {
+		e, err := it.Next()
+		if siter.IsFinished(err) {
+			break
+		} else if err != nil {
+			return false, err
+		}
+		if e.TaskId == ent.TaskId || !e.Valid(now) {
+			continue // this task, or one which has been abandoned
+		}
+		if e.Created.Before(ent.Created) || (e.Created.Equal(ent.Created) && e.TaskId.String() < ent.TaskId.String()) {
+			ahead++
+		}
+	}
+
+	return ahead < p.Limit, nil
+}
+
+// handleContended handles a task which was not admitted under its
+// concurrency policy. Its running entry is superseded so that it no longer
+// counts against the limit; the task is then either deferred or coalesced,
+// as the policy dictates.
+func (w *Executor) handleContended(cxt context.Context, msg *transport.Message, ent *worklog.Entry, p tasks.ConcurrencyPolicy) error {
+	opts := []worklog.NextOption{worklog.WithAttributes(msg.Attrs), worklog.WithTriggers(msg.Triggers)}
+
+	if p.Mode == tasks.Coalesce {
+		errdat, err := json.Marshal(jsonError{Err: fmt.Errorf("Task was coalesced with another running task: %s", ent.ConcurrencyKey())})
+		if err != nil {
+			return fmt.Errorf("Could not marshal worklog error on coalesce: %v", err)
+		}
+		next := ent.Next(worklog.Canceled, nil, opts...).SetRetry(false).SetError(errdat)
+		err = w.worklog.StoreEntry(cxt, next)
+		if errors.Is(err, worklog.ErrConflict) {
+			return nil // the task was updated elsewhere, e.g., it was canceled
+		} else if err != nil {
+			return fmt.Errorf("Could not store worklog entry on coalesce: %w", err)
+		}
+		if w.Verbose() {
+			msgLog(w.log, msg).Info("Coalesced task with another running task", "concurrency_key", ent.ConcurrencyKey())
+		}
+		return w.trigger(cxt, msg, next)
+	}
+
+	// the deferred task is pending until the delay elapses, at which point its
+	// entry expires so that the promoter publishes it should this node stop
+	// before it does
+	delay := p.Backoff()
+	next := ent.Next(worklog.Pending, msg.Data, opts...).SetExpires(time.Now().Add(delay))
+	err := w.worklog.StoreEntry(cxt, next)
+	if errors.Is(err, worklog.ErrConflict) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not store worklog entry on defer: %w", err)
+	}
+	w.deferContended(msg, next, delay)
+	return nil
+}
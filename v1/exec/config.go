@@ -6,18 +6,26 @@ import (
 
 	"github.com/bww/go-tasks/v1"
 	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-metrics/v1"
+	"github.com/bww/go-queue/v1"
 )
 
 type Config struct {
-	Nodename     string // the name of this node in the task cluster; by defualt we use the hostname
-	Queue        *tasks.Queue
-	Worklog      worklog.Worklog
-	Subscription string
-	Concurrency  int
-	EntryTTL     time.Duration // how long are non-terminal entries valid until they expire?
-	Logger       *slog.Logger
-	Debug        bool
-	Verbose      bool
+	Nodename      string // the name of this node in the task cluster; by defualt we use the hostname
+	Queue         *tasks.Queue
+	Worklog       worklog.Worklog
+	Subscription  string
+	Concurrency   int
+	EntryTTL      time.Duration     // how long are non-terminal entries valid until they expire?
+	WatchInterval time.Duration     // how often do running tasks check the worklog for cancellation?
+	Retry         tasks.RetryPolicy // the default policy for retrying failed managed tasks; routes may override it
+	DeadLetter    queue.Queue       // if provided, malformed messages and definitively failed tasks are sent here
+	Metrics       *metrics.Metrics  // if provided, the executor registers and reports its metrics here
+	StrictRoutes  bool              // if set, the executor refuses to run when its router has ambiguous or unreachable routes
+	Logger        *slog.Logger
+	Debug         bool
+	Verbose       bool
 }
 
 func (c Config) WithOptions(opts []Option) Config {
@@ -64,6 +72,41 @@ func WithEntryTTL(v time.Duration) Option {
 	}
 }
 
+func WithWatchInterval(v time.Duration) Option {
+	return func(c Config) Config {
+		c.WatchInterval = v
+		return c
+	}
+}
+
+func WithRetryPolicy(v tasks.RetryPolicy) Option {
+	return func(c Config) Config {
+		c.Retry = v
+		return c
+	}
+}
+
+func WithDeadLetter(v queue.Queue) Option {
+	return func(c Config) Config {
+		c.DeadLetter = v
+		return c
+	}
+}
+
+func WithMetrics(v *metrics.Metrics) Option {
+	return func(c Config) Config {
+		c.Metrics = v
+		return c
+	}
+}
+
+func WithStrictRoutes(v bool) Option {
+	return func(c Config) Config {
+		c.StrictRoutes = v
+		return c
+	}
+}
+
 func WithLogger(v *slog.Logger) Option {
 	return func(c Config) Config {
 		c.Logger = v
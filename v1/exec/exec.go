@@ -17,19 +17,22 @@ import (
 	"time"
 
 	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/deadletter"
 	"github.com/bww/go-tasks/v1/router"
+	"github.com/bww/go-tasks/v1/tracing"
 	"github.com/bww/go-tasks/v1/transport"
 	"github.com/bww/go-tasks/v1/worklog"
 
 	"github.com/bww/go-alert/v1"
 	"github.com/bww/go-ident/v1"
-	"github.com/bww/go-metrics/v1"
+	"github.com/bww/go-queue/v1"
 	errutil "github.com/bww/go-util/v1/errors"
 	"github.com/bww/go-util/v1/ext"
 	sliceutil "github.com/bww/go-util/v1/slices"
 	"github.com/bww/go-util/v1/text"
 	"github.com/dustin/go-humanize"
 	cmap "github.com/orcaman/concurrent-map/v2"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -40,10 +43,17 @@ var (
 	ErrUnsupported   = errors.New("Unsupported operation")
 	ErrInvalidConfig = errors.New("Invalid configuration")
 	ErrUnimplemented = errors.New("Unimplemented")
+	ErrTaskExpired   = errors.New("Task expired")
 )
 
-// the default timeout for operations
-const defaultTimeout = time.Second * 10
+// errSuperseded is the cause of cancellation for a task whose entry has been
+// superseded in the worklog by another writer while it was executing
+var errSuperseded = errors.New("Task was superseded")
+
+const (
+	defaultTimeout       = time.Second * 10 // the default timeout for operations
+	defaultWatchInterval = time.Second * 5  // the default interval at which running tasks check the worklog
+)
 
 type taskSpec struct {
 	context context.Context
@@ -60,20 +70,22 @@ type Executor struct {
 
 	nodename string
 	inflight cmap.ConcurrentMap[string, taskSpec]
+	retries  cmap.ConcurrentMap[string, retrySpec]
+	retry    tasks.RetryPolicy
+	dlq      queue.Queue
 	cn       int
 	ttl      time.Duration
+	wival    time.Duration
 	queue    *tasks.Queue
 	subscr   string
 	log      *slog.Logger
 	errs     chan error
+	strict   bool
 	verbose  bool
 	debug    bool
 	runid    uint64
 
-	metrics            *metrics.Metrics
-	taskSuccessCounter metrics.Counter
-	taskFailureCounter metrics.Counter
-	taskExecSampler    metrics.Sampler
+	metrics *execMetrics
 }
 
 func New(q *tasks.Queue, s string, opts ...Option) (*Executor, error) {
@@ -115,20 +127,20 @@ func NewWithConfig(conf Config) (*Executor, error) {
 		Router:   r,
 		nodename: nodename,
 		inflight: cmap.New[taskSpec](),
+		retries:  cmap.New[retrySpec](),
+		retry:    conf.Retry,
+		dlq:      conf.DeadLetter,
 		cn:       max(1, conf.Concurrency),
 		ttl:      max(time.Minute, conf.EntryTTL), // entry TTL; must be at least a minute
+		wival:    ext.Choose(conf.WatchInterval > 0, conf.WatchInterval, defaultWatchInterval),
 		queue:    conf.Queue,
-		worklog:  conf.Worklog,
+		worklog:  tracing.Worklog(conf.Worklog),
 		subscr:   conf.Subscription,
 		log:      conf.Logger.With("system", "tasks"),
+		strict:   conf.StrictRoutes,
 		verbose:  enableVerbose,
 		debug:    enableDebug,
-	}
-
-	if w.metrics != nil {
-		w.taskSuccessCounter = w.metrics.RegisterCounter("task_success", "Successful tasks", nil)
-		w.taskFailureCounter = w.metrics.RegisterCounter("task_failure", "Failed tasks", nil)
-		w.taskExecSampler = w.metrics.RegisterSampler("task_exec", "Task execution duration", nil)
+		metrics:  newExecMetrics(conf.Metrics),
 	}
 
 	return w, nil
@@ -146,7 +158,16 @@ func (w *Executor) Debug() bool {
 	return w.debug
 }
 
+// Run consumes and executes tasks until the context is canceled. If the
+// router has ambiguous or unreachable routes a warning is logged, or, if the
+// executor was configured with strict routes, Run fails immediately.
 func (w *Executor) Run(cxt context.Context) error {
+	if err := router.Check(w.Router); err != nil {
+		if w.strict {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		w.log.Warn("Router has conflicting routes", "error", err)
+	}
 	w.Lock()
 	cn := w.cn
 	subscr := w.subscr
@@ -188,7 +209,17 @@ outer:
 
 		msg, err := dlv.Message()
 		if err != nil {
+			w.metrics.taskMalformed()
 			w.report(err)
+			// if we have a dead-letter queue, the malformed message is moved there;
+			// otherwise it is left unacknowledged
+			if raw := dlv.Raw(); raw != nil && w.dlq != nil {
+				if err := w.deadLetter(raw, deadletter.Malformed, err); err != nil {
+					w.report(err)
+				} else {
+					dlv.Ack()
+				}
+			}
 			continue
 		}
 
@@ -196,6 +227,7 @@ outer:
 		// the pending state should already have been recorded in the worklog and
 		// the task may be retried from there should execution fail
 		dlv.Ack()
+		w.metrics.taskReceived(msg)
 
 		t := atomic.AddInt64(&total, 1)
 		log := msgLog(slog.Default(), msg)
@@ -209,18 +241,28 @@ outer:
 
 		sem <- struct{}{}
 		wg.Add(1)
-		atomic.AddInt64(&inflight, 1)
+		w.metrics.inflightChanged(atomic.AddInt64(&inflight, 1), cn)
 
 		go func(msg *transport.Message) {
-			defer func() { <-sem; wg.Done(); atomic.AddInt64(&inflight, -1) }()
+			defer func() { <-sem; wg.Done(); w.metrics.inflightChanged(atomic.AddInt64(&inflight, -1), cn) }()
+			// processing continues the trace of the publication, if there is one
+			cxt, span := tracing.Start(msg.TraceContext(cxt), "tasks.process", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+				tracing.AttrUTD.String(msg.UTD),
+				tracing.AttrTaskId.String(msg.Id.String()),
+				tracing.AttrType.String(string(msg.Type)),
+			))
 			now := time.Now()
 			var err error
-			switch msg.Type {
-			case transport.Managed:
+			switch {
+			case msg.Expired(now):
+				err = w.handleExpired(cxt, msg, now)
+			case !msg.Due(now):
+				err = w.handleEarly(cxt, msg, now)
+			case msg.Type == transport.Managed:
 				err = w.handleManaged(cxt, msg, now)
-			case transport.Oneshot:
+			case msg.Type == transport.Oneshot:
 				err = w.handleOneshot(cxt, msg, now)
-			case transport.Cronjob:
+			case msg.Type == transport.Cronjob:
 				err = w.handleCronjob(cxt, msg, now)
 			default:
 				err = fmt.Errorf("Task type is not supported: %v", msg.Type)
@@ -234,11 +276,13 @@ outer:
 				}
 				w.report(err)
 			}
+			tracing.End(span, err)
 		}(msg)
 	}
 
 	log.Info(fmt.Sprintf("Waiting for %d tasks to complete...\n", atomic.LoadInt64(&inflight)))
 	wg.Wait()
+	w.flushRetries()
 	return ErrStopped
 }
 
@@ -259,6 +303,20 @@ func (w *Executor) report(err error) {
 	}
 }
 
+func (w *Executor) deadLetter(raw *queue.Message, reason deadletter.Reason, cause error) error {
+	err := deadletter.Publish(w.dlq, raw, deadletter.Metadata{
+		Reason:       reason,
+		Error:        cause.Error(),
+		Node:         w.nodename,
+		Subscription: w.subscr,
+		Time:         time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("Could not publish to dead-letter queue: %w", err)
+	}
+	return nil
+}
+
 func (w *Executor) Errors() <-chan error {
 	w.Lock()
 	defer w.Unlock()
@@ -268,6 +326,95 @@ func (w *Executor) Errors() <-chan error {
 	return w.errs
 }
 
+// handleEarly handles a task which was delivered before it is due. This
+// occurs when the task was enqueued by a publisher which could not defer it,
+// e.g., because it has no worklog. Managed tasks are parked in the worklog
+// until they are promoted; other tasks are held by this executor.
+//
+// Parking a task requires that the queue the executor publishes to has a
+// worklog; otherwise, publishing the task would simply enqueue it again, so
+// it is held instead. Held tasks exist only in the memory of this executor:
+// they are republished if it stops gracefully, but they are lost if it does
+// not.
+func (w *Executor) handleEarly(cxt context.Context, msg *transport.Message, now time.Time) error {
+	if msg.Type != transport.Managed || w.worklog == nil || w.queue.Worklog() == nil {
+		w.deferMessage(msg, msg.NotBefore.Sub(now))
+		return nil
+	}
+
+	opts := []tasks.PublishOption{tasks.WithRunAt(*msg.NotBefore)}
+	if msg.Id != ident.Zero {
+		ent, err := w.worklog.FetchLatestEntryForTask(cxt, msg.Id)
+		if err == nil {
+			if ent.State != worklog.Pending {
+				return fmt.Errorf("Task was delivered early but is not pending: %v", ent.State)
+			}
+			msg.Seq = ent.TaskSeq + 1 // publishing with a sequence appends to the existing log
+			opts = append(opts, tasks.WithStateSeq(ent.StateSeq))
+		} else if !errors.Is(err, worklog.ErrNotFound) {
+			return fmt.Errorf("Could not fetch worklog entry: %v", err)
+		}
+	}
+
+	err := w.queue.Publish(cxt, msg, opts...)
+	if err != nil {
+		return fmt.Errorf("Could not defer task: %w", err)
+	}
+	if w.Verbose() {
+		msgLog(w.log, msg).Info("Deferred task which was delivered early", "not_before", *msg.NotBefore)
+	}
+	return nil
+}
+
+// handleExpired handles a task which expired before it ran. The task is not
+// executed; if it is managed it is resolved as Lapsed in the worklog, and
+// triggers for that state are evaluated as usual.
+func (w *Executor) handleExpired(cxt context.Context, msg *transport.Message, now time.Time) error {
+	w.metrics.taskExpired(w.route(msg), msg)
+	exp, _ := msg.ExpiresAt()
+	msgLog(w.log, msg).Info("Task expired before it ran; discarding", "expires_at", exp)
+	setState(cxt, worklog.Lapsed)
+
+	if msg.Type != transport.Managed && msg.Type != transport.Cronjob {
+		return nil
+	}
+	if w.worklog == nil {
+		return fmt.Errorf("%w: Worklog is not available, cannot manage tasks", ErrUnsupported)
+	}
+	if msg.Id == ident.Zero {
+		return ErrMissingIdent
+	}
+
+	ent, err := w.worklog.FetchLatestEntryForTask(cxt, msg.Id)
+	if err != nil && !errors.Is(err, worklog.ErrNotFound) {
+		return fmt.Errorf("Could not fetch worklog entry: %v", err)
+	}
+	if ent != nil && ent.State.Resolved() {
+		return nil // the task was resolved elsewhere, e.g., it was canceled
+	}
+
+	errdat, err := json.Marshal(jsonError{Err: fmt.Errorf("%w at %v", ErrTaskExpired, exp)})
+	if err != nil {
+		return fmt.Errorf("Could not marshal worklog error on expiry: %v", err)
+	}
+	var next *worklog.Entry
+	if ent != nil {
+		next = ent.Next(worklog.Lapsed, nil, worklog.WithAttributes(msg.Attrs), worklog.WithTriggers(msg.Triggers)).SetRetry(false)
+		err = w.worklog.StoreEntry(cxt, next.SetError(errdat))
+	} else {
+		next = msg.Entry(worklog.Lapsed, now)
+		err = w.worklog.CreateEntry(cxt, next.SetError(errdat))
+	}
+	if errors.Is(err, worklog.ErrConflict) {
+		msgLog(w.log, msg).Info("Task was updated before its expiry could be recorded; skipping")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not store worklog entry on expiry: %w", err)
+	}
+
+	return w.trigger(cxt, msg, next)
+}
+
 func (w *Executor) handleCronjob(cxt context.Context, msg *transport.Message, now time.Time) error {
 	if w.worklog == nil {
 		return fmt.Errorf("%w: Worklog is not available, cannot manage tasks", ErrUnsupported)
@@ -287,7 +434,7 @@ func (w *Executor) handleCronjob(cxt context.Context, msg *transport.Message, no
 		Created: now,
 	}
 	err := w.worklog.CreateEntry(cxt, ent)
-	if err != nil && !errors.Is(err, worklog.ErrNotFound) {
+	if err != nil && !errors.Is(err, worklog.ErrConflict) { // the entry may have been created by the scheduler
 		return fmt.Errorf("Could not initialize worklog entry: %v", err)
 	}
 
@@ -307,17 +454,32 @@ func (w *Executor) handleManaged(cxt context.Context, msg *transport.Message, no
 		return fmt.Errorf("Could not fetch worklog entry: %v", err)
 	}
 
+	conc, limited := w.concurrencyPolicy(msg)
+	if limited {
+		msg.SetAttr(worklog.AttrConcurrencyKey, conc.KeyFor(msg.UTD))
+	}
+
 	var next *worklog.Entry
 	if ent != nil {
 		if ent.State == worklog.Complete {
 			return fmt.Errorf("Task is already completed")
+		} else if ent.State == worklog.Canceled {
+			msgLog(w.log, msg).Info("Task was canceled before it ran; skipping")
+			return w.trigger(cxt, msg, ent)
 		} else if ent.State == worklog.Running && ent.Valid(now) {
 			return fmt.Errorf("Task is already running since: %v", ent.Created)
 		}
-		next = ent.Next(worklog.Running, msg.Data, worklog.WithAttributes(msg.Attrs))
+		next = ent.Next(worklog.Running, msg.Data, worklog.WithAttributes(msg.Attrs), worklog.WithTriggers(msg.Triggers))
 	} else {
 		next = msg.Entry(worklog.Running, now)
 	}
+	// the running entry holds a lease until it expires; it is renewed while the
+	// task is executing and, should this node die, it may be recovered by the
+	// reaper once it expires
+	next.SetExpires(now.Add(w.ttl))
+	// the running entry is stamped as late as possible, immediately before it is
+	// stored, since concurrency admission orders running tasks by that time
+	next.Created = time.Now()
 
 	err = w.worklog.StoreEntry(cxt, next) // Entry must be initialized
 	if err != nil {
@@ -328,6 +490,17 @@ func (w *Executor) handleManaged(cxt context.Context, msg *transport.Message, no
 		}
 	}
 
+	// a task with a concurrency limit is admitted only once its running entry
+	// is recorded, so that other nodes observe it when they decide
+	if limited {
+		ok, err := w.admit(cxt, next, conc, now)
+		if err != nil {
+			return fmt.Errorf("Could not evaluate concurrency limit: %w", err)
+		} else if !ok {
+			return w.handleContended(cxt, msg, next, conc)
+		}
+	}
+
 	taskId := next.TaskId.String()
 	cxt, cancel := context.WithCancel(cxt)
 	defer func() {
@@ -342,11 +515,27 @@ func (w *Executor) handleManaged(cxt context.Context, msg *transport.Message, no
 		entry:   next,
 	})
 
+	var (
+		retries, _ = msg.Attrs.Int(worklog.AttrRetries) // if the attribute is missing or malformed we start from zero
+		policy     = w.retryPolicy(msg)
+	)
 	res, err := w.proc(cxt, msg, next, now)
-	if err == nil {
-		next = next.Next(worklog.Complete, res.State)
+	state := worklog.Complete
+	if errors.Is(err, errSuperseded) {
+		return w.handleSuperseded(cxt, msg, next)
+	} else if err == nil {
+		next = next.Next(worklog.Complete, res.State).SetRetry(false)
 	} else {
-		next = next.Next(stateForError(err), res.State).SetRetry(errutil.Recoverable(err))
+		// only failures, not cancellations, which are recoverable may be retried,
+		// and only while the retry policy permits it; otherwise, the task is
+		// definitively failed. A task which will be retried returns to Pending
+		// until the retry is due.
+		state = stateForError(err)
+		if state == worklog.Failed && tasks.IsRecoverable(err) && policy.Permits(retries) {
+			next = retryEntry(cxt, msg, next, retries+1, time.Now().Add(policy.Delay(retries+1)))
+		} else {
+			next = next.Next(state, res.State).SetRetry(false)
+		}
 		errdat, suberr := json.Marshal(jsonError{Err: err})
 		if suberr != nil {
 			alert.Error(fmt.Errorf("Could not marshal worklog error on failure: %v", suberr), alert.WithTags(msgTags(msg, alert.Tags{"task_seq": fmt.Sprint(next.TaskSeq)})))
@@ -355,41 +544,124 @@ func (w *Executor) handleManaged(cxt context.Context, msg *transport.Message, no
 		}
 	}
 
-	if run, enq, ok := msg.TriggerForState(next.State); ok {
-		err := w.queue.Submit(cxt, transport.New(run).SetTriggers(enq))
-		if err != nil {
-			return fmt.Errorf("Could not enqueue dependent task for trigger: %v: %w", run, err)
+	setState(cxt, state)
+
+	// As a special case, we create a new context for triggers and storing
+	// state. if the original context was canceled or timed out, we don't want
+	// that to affect these operations; it retains the original's values, so
+	// these operations are still traced as part of the task
+	subcxt, cancel := context.WithTimeout(context.WithoutCancel(cxt), defaultTimeout)
+	defer cancel()
+
+	// triggers are only evaluated once the task reaches a definitive state; a
+	// task which will be retried has not. A task which failed definitively is
+	// handled once its failure is recorded, below.
+	if !next.Retry && next.State != worklog.Failed {
+		if trgerr := w.trigger(subcxt, msg, next); trgerr != nil {
+			return trgerr
 		}
 	}
 
-	// As a special case, we create a new context for storing state. if the
-	// original context was canceled or timed out, we don't want that to affect
-	// this operation
-	subcxt, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
 	suberr := w.worklog.StoreEntry(subcxt, next)
-	if suberr != nil {
+	if errors.Is(suberr, worklog.ErrConflict) && w.isCanceled(subcxt, next.TaskId) {
+		msgLog(w.log, msg).Info("Task was canceled elsewhere while finishing; cancellation stands")
+	} else if suberr != nil {
 		alert.Error(fmt.Errorf("Could not store worklog entry on success: %w", suberr), alert.WithTags(msgTags(msg, alert.Tags{"task_seq": fmt.Sprint(next.TaskSeq)})))
+	} else if next.Retry {
+		w.scheduleRetry(msg, next, retries+1)
+	} else if next.State == worklog.Complete && msg.Workflow != nil {
+		// workflow steps are advanced only once this step's completion is
+		// recorded, so that whichever parent of a join finishes last is
+		// guaranteed to observe the others as complete
+		suberr := w.queue.Advance(subcxt, msg.Workflow)
+		if suberr != nil {
+			alert.Error(fmt.Errorf("Could not advance workflow: %w", suberr), alert.WithTags(msgTags(msg, alert.Tags{"task_seq": fmt.Sprint(next.TaskSeq), "workflow_id": msg.Workflow.Id.String()})))
+		}
+	} else if next.State == worklog.Failed {
+		// a definitive failure is handled in the same way as that of a task which
+		// is failed by the reaper after it exhausts its recoveries
+		suberr := w.queue.Fail(subcxt, msg, next, tasks.Failure{
+			Cause:        err,
+			DeadLetter:   w.dlq,
+			Node:         w.nodename,
+			Subscription: w.subscr,
+		})
+		if suberr != nil {
+			alert.Error(fmt.Errorf("Could not handle failed task: %w", suberr), alert.WithTags(msgTags(msg, alert.Tags{"task_seq": fmt.Sprint(next.TaskSeq)})))
+		}
 	}
 
 	return err
 }
 
-func (w *Executor) handleOneshot(cxt context.Context, msg *transport.Message, now time.Time) error {
-	_, err := w.proc(cxt, msg, nil, now)
-	if err != nil {
-		return err
+// handleSuperseded is invoked when the entry for a running task is superseded
+// by another writer, which stops the task. This occurs when the task is
+// canceled, in which case the cancellation is already recorded and we are
+// only responsible for its triggers, or when the task is recovered by the
+// reaper after its lease expired, in which case it belongs to whoever
+// executes it next.
+func (w *Executor) handleSuperseded(cxt context.Context, msg *transport.Message, ent *worklog.Entry) error {
+	subcxt, cancel := context.WithTimeout(context.WithoutCancel(cxt), defaultTimeout)
+	defer cancel()
+	if lst, ok := w.canceled(subcxt, ent.TaskId); ok {
+		msgLog(w.log, msg).Info("Task was canceled while running")
+		return w.trigger(subcxt, msg, lst)
+	} else {
+		msgLog(w.log, msg).Info("Task was superseded while running; abandoning")
+		return nil
+	}
+}
+
+// canceled determines if the latest entry for a task is Canceled, and if so
+// produces it
+func (w *Executor) canceled(cxt context.Context, id ident.Ident) (*worklog.Entry, bool) {
+	ent, err := w.worklog.FetchLatestEntryForTask(cxt, id)
+	if err != nil || ent.State != worklog.Canceled {
+		return nil, false
 	}
+	return ent, true
+}
+
+func (w *Executor) isCanceled(cxt context.Context, id ident.Ident) bool {
+	_, ok := w.canceled(cxt, id)
+	return ok
+}
+
+// trigger submits the dependent task for the state of the entry the task
+// resolved with, if there is one
+func (w *Executor) trigger(cxt context.Context, msg *transport.Message, ent *worklog.Entry) error {
+	return w.queue.Trigger(cxt, msg, ent)
+}
+
+// Cancel cancels a task which is executing on this node, returning true if
+// the task was found. To cancel a task wherever it is executing in the
+// cluster, use [github.com/bww/go-tasks/v1.Queue.Cancel].
+func (w *Executor) Cancel(id ident.Ident) bool {
+	spec, ok := w.inflight.Get(id.String())
+	if ok {
+		spec.cancel()
+	}
+	return ok
+}
 
+func (w *Executor) handleOneshot(cxt context.Context, msg *transport.Message, now time.Time) error {
+	res, err := w.proc(cxt, msg, nil, now)
 	state := worklog.Complete
-	if run, enq, ok := msg.TriggerForState(state); ok {
-		err := w.handleOneshot(cxt, transport.New(run).SetTriggers(enq), now)
-		if err != nil {
-			return fmt.Errorf("Could not process dependent task for trigger: %v: %w", run, err)
-		}
+	if err != nil {
+		state = stateForError(err)
 	}
 
-	return nil
+	// oneshot tasks are not logged, but triggers are evaluated in the same way
+	// as they are for managed tasks, with an entry that describes the outcome;
+	// as with managed tasks, use a fresh context in case the original ended
+	setState(cxt, state)
+	subcxt, cancel := context.WithTimeout(context.WithoutCancel(cxt), defaultTimeout)
+	defer cancel()
+	trgerr := w.trigger(subcxt, msg, msg.Entry(state, time.Now()).SetData(res.State))
+	if err != nil {
+		return err
+	}
+	return trgerr
 }
 
 func (w *Executor) Proc(cxt context.Context, msg *transport.Message, ent *worklog.Entry) (res tasks.Result, err error) {
@@ -405,22 +677,18 @@ func (w *Executor) proc(cxt context.Context, msg *transport.Message, ent *worklo
 		log.Info("Running task")
 	}
 
+	route := w.route(msg)
+	cxt, span := tracing.Start(cxt, "tasks.exec", trace.WithAttributes(
+		tracing.AttrUTD.String(msg.UTD),
+		tracing.AttrTaskId.String(msg.Id.String()),
+		tracing.AttrRoute.String(route),
+	))
 	defer func() {
-		if w.taskExecSampler != nil {
-			w.taskExecSampler.Observe(float64(time.Since(now)))
-		}
 		if r := recover(); r != nil {
 			err = errors.New(fmt.Sprintf("panic: %v\n%s", r, string(debug.Stack())))
 		}
-		if err != nil {
-			if w.taskFailureCounter != nil {
-				w.taskFailureCounter.Inc()
-			}
-		} else {
-			if w.taskSuccessCounter != nil {
-				w.taskSuccessCounter.Inc()
-			}
-		}
+		w.metrics.taskFinished(route, msg, time.Since(now), err)
+		tracing.End(span, err)
 	}()
 
 	u, err := url.Parse(msg.UTD)
@@ -428,35 +696,22 @@ func (w *Executor) proc(cxt context.Context, msg *transport.Message, ent *worklo
 		return res, fmt.Errorf("Invalid UTD: %w", err)
 	}
 
-	cxt, cancel := context.WithCancel(cxt)
-	defer cancel()
+	cxt, cancel := context.WithCancelCause(cxt)
+	defer cancel(nil)
 
 	if ent != nil {
-		go func() {
-			for {
-				select {
-				case <-cxt.Done():
-					return
-				case <-time.After(w.ttl / 2):
-					if w.Verbose() || w.Debug() {
-						log.Debug("Renew lease", "entry", ent, "window", w.ttl)
-					}
-					prv := ent
-					ent, err = w.worklog.RenewEntry(cxt, ent, now.Add(w.ttl))
-					if err != nil {
-						alert.Error(fmt.Errorf("Could not renew worklog entry: %v", err), alert.WithTags(msgTags(msg, alert.Tags{"worklog": prv.String()})))
-					}
-				}
-			}
-		}()
+		go w.watch(cxt, cancel, msg, ent)
 	}
 
 	res, err = w.Router.Exec(cxt, &tasks.Request{
 		Run:    w.nextRun(),
 		UTD:    u,
 		Entity: msg.Data,
+		Attrs:  msg.Attrs,
 	})
-	if errors.Is(err, tasks.ErrUnsupported) {
+	if cause := context.Cause(cxt); errors.Is(cause, errSuperseded) {
+		return res, cause
+	} else if errors.Is(err, tasks.ErrUnsupported) {
 		return res, err
 	} else if errors.Is(err, context.Canceled) {
 		return res, err
@@ -470,6 +725,61 @@ func (w *Executor) proc(cxt context.Context, msg *transport.Message, ent *worklo
 	return res, nil
 }
 
+// watch maintains the lease on a running task's entry, renewing it well
+// before it expires, and checks that the entry has not been superseded by
+// another writer, e.g., because the task was canceled. If it has, the task
+// is canceled with the cause errSuperseded.
+func (w *Executor) watch(cxt context.Context, cancel context.CancelCauseFunc, msg *transport.Message, ent *worklog.Entry) {
+	log := msgLog(w.log, msg)
+	renewed := time.Now()
+	for {
+		select {
+		case <-cxt.Done():
+			return
+		case <-time.After(min(w.wival, w.ttl/2)):
+			// check the entry
+		}
+
+		lst, err := w.worklog.FetchLatestEntryForTask(cxt, ent.TaskId)
+		if err != nil {
+			if cxt.Err() == nil {
+				alert.Error(fmt.Errorf("Could not check worklog entry: %v", err), alert.WithTags(msgTags(msg, alert.Tags{"worklog": ent.String()})))
+			}
+			continue
+		} else if lst.TaskSeq != ent.TaskSeq {
+			log.Info("Task entry was superseded; stopping", "worklog", lst.String(), "state", lst.State)
+			cancel(errSuperseded)
+			return
+		}
+
+		if time.Since(renewed) < w.ttl/2 {
+			continue
+		}
+		if w.Verbose() || w.Debug() {
+			log.Debug("Renew lease", "entry", ent, "window", w.ttl)
+		}
+		rcxt, span := tracing.Start(cxt, "tasks.renew", trace.WithAttributes(tracing.EntryAttributes(ent)...))
+		ren, err := w.worklog.RenewEntry(rcxt, ent, time.Now().Add(w.ttl))
+		tracing.End(span, err)
+		w.metrics.leaseRenewed(err)
+		if errors.Is(err, worklog.ErrConflict) {
+			log.Info("Task entry was superseded on renewal; stopping", "worklog", ent.String())
+			cancel(errSuperseded)
+			return
+		} else if err != nil {
+			alert.Error(fmt.Errorf("Could not renew worklog entry: %v", err), alert.WithTags(msgTags(msg, alert.Tags{"worklog": ent.String()})))
+		} else {
+			ent, renewed = ren, time.Now()
+		}
+	}
+}
+
+// setState records the state a task resolved with on the span of the
+// context, if there is one
+func setState(cxt context.Context, state worklog.State) {
+	trace.SpanFromContext(cxt).SetAttributes(tracing.AttrState.String(string(state)))
+}
+
 func msgLog(base *slog.Logger, msg *transport.Message) *slog.Logger {
 	if base == nil {
 		base = slog.Default()
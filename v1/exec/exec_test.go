@@ -0,0 +1,719 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/promoter"
+	"github.com/bww/go-tasks/v1/router"
+	"github.com/bww/go-tasks/v1/tracing"
+	"github.com/bww/go-tasks/v1/tracing/tracingtest"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/memory"
+
+	"github.com/bww/go-ident/v1"
+	"github.com/bww/go-metrics/v1"
+	"github.com/bww/go-queue/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExecutor(t *testing.T, opts ...Option) (*Executor, *tasks.Queue) {
+	q := tasks.NewQueue(queuetest.New(), memory.New())
+	w, err := New(q, "test", append([]Option{WithWorklog(q.Worklog())}, opts...)...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return w, q
+}
+
+// await polls until the latest entry for a task satisfies the predicate
+func await(t *testing.T, wl worklog.Worklog, msg *transport.Message, check func(*worklog.Entry) bool) *worklog.Entry {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		ent, err := wl.FetchLatestEntryForTask(context.Background(), msg.Id)
+		if err == nil && check(ent) {
+			return ent
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatalf("Timed out waiting for task: %v", msg.Id)
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t, WithRetryPolicy(tasks.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	var attempts, exhausted int32
+	w.Add("test://flaky", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return tasks.Result{}, tasks.NewRecoverable(errors.New("Try again"))
+		}
+		return tasks.Result{State: []byte("ok")}, nil
+	}))
+	w.Add("test://broken", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		atomic.AddInt32(&exhausted, 1)
+		return tasks.Result{}, tasks.NewRecoverable(errors.New("Never works"))
+	})).Retry(tasks.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	go w.Run(cxt)
+
+	flaky := transport.New("test://flaky")
+	assert.NoError(t, q.Publish(cxt, flaky))
+	ent := await(t, q.Worklog(), flaky, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(t, "2", ent.Attrs[worklog.AttrRetries])
+	assert.False(t, ent.Retry)
+
+	broken := transport.New("test://broken")
+	assert.NoError(t, q.Publish(cxt, broken))
+	ent = await(t, q.Worklog(), broken, func(e *worklog.Entry) bool { return e.State == worklog.Failed && !e.Retry })
+	assert.Equal(t, int32(2), atomic.LoadInt32(&exhausted)) // the route policy overrides the default
+	assert.Equal(t, "1", ent.Attrs[worklog.AttrRetries])
+}
+
+func TestRetryDurable(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t, WithRetryPolicy(tasks.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}))
+	var attempts int32
+	w.Add("test://flaky", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			return tasks.Result{}, tasks.NewRecoverable(errors.New("Try again"))
+		}
+		return tasks.Result{}, nil
+	}))
+	w.Add("test://broken", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, tasks.NewRecoverable(errors.New("Never works"))
+	}))
+	go w.Run(cxt)
+
+	// a task waiting to be retried is pending until the retry is due...
+	now := time.Now()
+	flaky := transport.New("test://flaky")
+	assert.NoError(t, q.Publish(cxt, flaky))
+	ent := await(t, q.Worklog(), flaky, func(e *worklog.Entry) bool { return e.State == worklog.Pending && e.Retry })
+	if assert.NotNil(t, ent.Expires) {
+		assert.WithinDuration(t, now.Add(time.Hour), *ent.Expires, time.Minute)
+	}
+	assert.Equal(t, "1", ent.Attrs[worklog.AttrRetries])
+	assert.NotEmpty(t, ent.Error)
+
+	// ...so it is published by the promoter if this node does not publish it
+	p, err := promoter.New(q)
+	if assert.NoError(t, err) {
+		n, err := p.Promote(cxt, now.Add(time.Hour*2))
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, n)
+		}
+		await(t, q.Worklog(), flaky, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+		assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	}
+
+	// and it may be canceled while it waits
+	broken := transport.New("test://broken")
+	assert.NoError(t, q.Publish(cxt, broken))
+	await(t, q.Worklog(), broken, func(e *worklog.Entry) bool { return e.State == worklog.Pending && e.Retry })
+	ent, err = q.Cancel(cxt, broken.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Canceled, ent.State)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dlq := queuetest.New()
+	w, q := newTestExecutor(t, WithDeadLetter(dlq))
+	w.Add("test://broken", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, errors.New("Never works")
+	}))
+	go w.Run(cxt)
+
+	assert.NoError(t, q.Queue.Publish(&queue.Message{Data: []byte("This is not a task")}))
+	d, err := dlq.ReceiveWithTimeout(time.Second * 5)
+	if !assert.NoError(t, err, "Timed out waiting for dead letter") {
+		return
+	}
+	assert.Equal(t, "This is not a task", string(d.Message().Data))
+	assert.Equal(t, "malformed", d.Message().Attributes["dl_reason"])
+
+	broken := transport.New("test://broken")
+	assert.NoError(t, q.Publish(cxt, broken))
+	d, err = dlq.ReceiveWithTimeout(time.Second * 5)
+	if !assert.NoError(t, err, "Timed out waiting for dead letter") {
+		return
+	}
+	msg, err := transport.Parse(d.Message())
+	if assert.NoError(t, err) {
+		assert.Equal(t, broken.Id, msg.Id)
+	}
+	assert.Equal(t, "failed", d.Message().Attributes["dl_reason"])
+	assert.Contains(t, d.Message().Attributes["dl_error"], "Never works")
+}
+
+func TestCancel(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t, WithWatchInterval(time.Millisecond*10))
+	var ran, after int32
+	started := make(chan struct{}, 1)
+	w.Add("test://block", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		atomic.AddInt32(&ran, 1)
+		started <- struct{}{}
+		<-cxt.Done()
+		return tasks.Result{}, cxt.Err()
+	}))
+	w.Add("test://after", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		atomic.AddInt32(&after, 1)
+		return tasks.Result{}, nil
+	}))
+
+	// a task which is canceled before it runs is skipped
+	pending := transport.New("test://block").AddTrigger(worklog.Canceled, "test://after")
+	assert.NoError(t, q.Publish(cxt, pending))
+	_, err := q.Cancel(cxt, pending.Id)
+	assert.NoError(t, err)
+	go w.Run(cxt)
+
+	// a task which is canceled while it runs is stopped
+	running := transport.New("test://block").AddTrigger(worklog.Canceled, "test://after")
+	assert.NoError(t, q.Publish(cxt, running))
+	select {
+	case <-started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for task to start")
+	}
+	ent, err := q.Cancel(cxt, running.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Canceled, ent.State)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt32(&after) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ran))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&after))
+	assert.Len(t, w.inflight.Keys(), 0)
+
+	// canceling a resolved task is an error
+	_, err = q.Cancel(cxt, running.Id)
+	assert.ErrorIs(t, err, worklog.ErrResolved)
+}
+
+func TestWorkflow(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t)
+	var (
+		lock sync.Mutex
+		ran  []string
+	)
+	step := tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		ran = append(ran, params.Vars["step"])
+		return tasks.Result{}, nil
+	})
+	w.Add("test://step/{step}", step)
+	go w.Run(cxt)
+
+	// a fans out to b and c, which fan in to d
+	wf := worklog.NewWorkflow().
+		AddStep("a", "test://step/a", nil).
+		AddStep("b", "test://step/b", nil, "a").
+		AddStep("c", "test://step/c", nil, "a").
+		AddStep("d", "test://step/d", nil, "b", "c")
+	assert.NoError(t, q.PublishWorkflow(cxt, wf))
+
+	join := transport.NewStep(wf, "d")
+	ent := await(t, q.Worklog(), join, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	assert.Equal(t, wf.Id, ent.WorkflowId())
+
+	time.Sleep(time.Millisecond * 50) // give any duplicate a chance to run
+	lock.Lock()
+	defer lock.Unlock()
+	if assert.Len(t, ran, 4) {
+		assert.Equal(t, "a", ran[0])
+		assert.ElementsMatch(t, []string{"b", "c"}, ran[1:3])
+		assert.Equal(t, "d", ran[3])
+	}
+}
+
+func TestWorkflowRetry(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t, WithRetryPolicy(tasks.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	var attempts int32
+	w.Add("test://step/a", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			return tasks.Result{}, tasks.NewRecoverable(errors.New("Try again"))
+		}
+		return tasks.Result{}, nil
+	}))
+	w.Add("test://step/b", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	// a fails once and is retried; the workflow advances once the retry completes
+	wf := worklog.NewWorkflow().
+		AddStep("a", "test://step/a", nil).
+		AddStep("b", "test://step/b", nil, "a")
+	assert.NoError(t, q.PublishWorkflow(cxt, wf))
+
+	ent := await(t, q.Worklog(), transport.NewStep(wf, "b"), func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	assert.Equal(t, wf.Id, ent.WorkflowId())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestTriggerForward(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t)
+	reqs := make(chan *tasks.Request, 10)
+	w.Add("test://produce", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{State: []byte(`{"file":"a.csv","rows":10}`)}, nil
+	}))
+	w.Add("test://consume", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		reqs <- req
+		return tasks.Result{State: req.Entity}, nil
+	}))
+	go w.Run(cxt)
+
+	recv := func() *tasks.Request {
+		select {
+		case req := <-reqs:
+			return req
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timed out waiting for dependent task")
+			return nil
+		}
+	}
+
+	// the result is forwarded as the entity down the entire chain
+	data := transport.New("test://produce").SetForward(transport.ForwardData).AddTrigger(worklog.Complete, "test://consume", "test://consume")
+	assert.NoError(t, q.Publish(cxt, data))
+	req := recv()
+	assert.Equal(t, `{"file":"a.csv","rows":10}`, string(req.Entity))
+	assert.Equal(t, data.Id.String(), req.Attrs[worklog.AttrParentId])
+	assert.Equal(t, string(worklog.Complete), req.Attrs[worklog.AttrParentState])
+	req = recv()
+	assert.Equal(t, `{"file":"a.csv","rows":10}`, string(req.Entity))
+	assert.NotEqual(t, data.Id.String(), req.Attrs[worklog.AttrParentId])
+
+	// the result is merged into attributes
+	merge := transport.New("test://produce").SetForward(transport.ForwardAttrs).AddTrigger(worklog.Complete, "test://consume")
+	assert.NoError(t, q.Publish(cxt, merge))
+	req = recv()
+	assert.Nil(t, req.Entity)
+	assert.Equal(t, "a.csv", req.Attrs["file"])
+	assert.Equal(t, "10", req.Attrs["rows"])
+	assert.Equal(t, merge.Id.String(), req.Attrs[worklog.AttrParentId])
+
+	// by default, only provenance is provided
+	plain := transport.New("test://produce").AddTrigger(worklog.Complete, "test://consume")
+	assert.NoError(t, q.Publish(cxt, plain))
+	req = recv()
+	assert.Nil(t, req.Entity)
+	assert.Equal(t, plain.Id.String(), req.Attrs[worklog.AttrParentId])
+	assert.Equal(t, "", req.Attrs["file"])
+}
+
+func TestOneshotTriggers(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t)
+	reqs := make(chan *tasks.Request, 10)
+	w.Add("test://ok", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	}))
+	w.Add("test://broken", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, errors.New("Never works")
+	}))
+	w.Add("test://canceled", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, context.Canceled
+	}))
+	w.Add("test://after/{state}", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		reqs <- req
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	oneshot := func(utd string) *transport.Message {
+		m := transport.New(utd)
+		m.Type = transport.Oneshot
+		for _, s := range []worklog.State{worklog.Complete, worklog.Failed, worklog.Canceled} {
+			m.AddTrigger(s, "test://after/"+string(s))
+		}
+		return m
+	}
+
+	tests := []struct {
+		utd    string
+		expect worklog.State
+	}{
+		{"test://ok", worklog.Complete},
+		{"test://broken", worklog.Failed},
+		{"test://canceled", worklog.Canceled},
+	}
+	for _, e := range tests {
+		assert.NoError(t, q.Publish(cxt, oneshot(e.utd)))
+		select {
+		case req := <-reqs:
+			assert.Equal(t, "test://after/"+string(e.expect), req.UTD.String())
+			assert.Equal(t, string(e.expect), req.Attrs[worklog.AttrParentState])
+		case <-time.After(time.Second * 5):
+			t.Fatalf("Timed out waiting for %v trigger: %s", e.expect, e.utd)
+		}
+	}
+}
+
+func TestConflictingRoutes(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	task := tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	})
+
+	// conflicting routes are reported, but the executor runs
+	w, q := newTestExecutor(t)
+	w.Add("test://a/{x}/c", task)
+	w.Add("test://a/b/{y}", task)
+	errs := make(chan error, 1)
+	go func() { errs <- w.Run(cxt) }()
+	msg := transport.NewWithId(ident.New(), "test://a/b/c")
+	assert.NoError(t, q.Publish(cxt, msg))
+	await(t, q.Worklog(), msg, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	assert.Len(t, errs, 0)
+
+	// a strict executor refuses to run
+	w, _ = newTestExecutor(t, WithStrictRoutes(true))
+	w.Add("test://a/{x}/c", task)
+	w.Add("test://a/b/{y}", task)
+	err := w.Run(cxt)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.ErrorIs(t, err, router.ErrAmbiguous)
+}
+
+func TestEarlyDelivery(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t)
+	ran := make(chan time.Time, 10)
+	w.Add("test://deferred", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		ran <- time.Now()
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	// a managed task which is delivered early is parked in the worklog
+	due := time.Now().Add(time.Hour)
+	managed := transport.NewWithId(ident.New(), "test://deferred").SetNotBefore(due)
+	c, err := managed.Encode()
+	if assert.NoError(t, err) {
+		assert.NoError(t, q.Queue.Publish(c))
+	}
+	ent := await(t, q.Worklog(), managed, func(e *worklog.Entry) bool { return e.State == worklog.Pending })
+	if assert.NotNil(t, ent.Expires) {
+		assert.True(t, ent.Expires.Equal(due))
+	}
+
+	// a oneshot task which is delivered early is held until it is due
+	start := time.Now()
+	oneshot := transport.New("test://deferred").SetNotBefore(start.Add(time.Millisecond * 100))
+	oneshot.Type = transport.Oneshot
+	c, err = oneshot.Encode()
+	if assert.NoError(t, err) {
+		assert.NoError(t, q.Queue.Publish(c))
+	}
+	select {
+	case when := <-ran:
+		assert.GreaterOrEqual(t, when.Sub(start), time.Millisecond*100)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for deferred task")
+	}
+	assert.Len(t, ran, 0) // the managed task has not run
+}
+
+func TestEarlyDeliveryWithoutParking(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the executor has a worklog but the queue it publishes to does not, so
+	// early tasks cannot be parked and are held instead
+	wl := memory.New()
+	tq := queuetest.New()
+	q := tasks.NewQueue(tq, nil)
+	w, err := New(q, "test", WithWorklog(wl))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ran := make(chan time.Time, 10)
+	w.Add("test://deferred", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		ran <- time.Now()
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	start := time.Now()
+	managed := transport.NewWithId(ident.New(), "test://deferred").SetNotBefore(start.Add(time.Millisecond * 200))
+	c, err := managed.Encode()
+	if assert.NoError(t, err) {
+		assert.NoError(t, q.Queue.Publish(c))
+	}
+	select {
+	case when := <-ran:
+		assert.GreaterOrEqual(t, when.Sub(start), time.Millisecond*200)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for deferred task")
+	}
+	await(t, wl, managed, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	assert.Len(t, ran, 0)
+	assert.Len(t, tq.Published(), 2) // delivered early, then once due
+}
+
+func TestExpired(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t)
+	ran := make(chan string, 10)
+	w.Add("test://{name}", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		ran <- req.UTD.String()
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	// an expired task is recorded as lapsed and is not run, but its triggers are
+	expired := transport.NewWithId(ident.New(), "test://expired").AddTrigger(worklog.Lapsed, "test://after")
+	assert.NoError(t, q.Publish(cxt, expired, tasks.WithExpiresAt(time.Now().Add(-time.Second))))
+	ent := await(t, q.Worklog(), expired, func(e *worklog.Entry) bool { return e.State == worklog.Lapsed })
+	assert.Contains(t, string(ent.Error), ErrTaskExpired.Error())
+
+	select {
+	case utd := <-ran:
+		assert.Equal(t, "test://after", utd)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for trigger")
+	}
+
+	// a task which has not yet expired runs as usual
+	live := transport.NewWithId(ident.New(), "test://live")
+	assert.NoError(t, q.Publish(cxt, live, tasks.WithTTL(time.Hour)))
+	await(t, q.Worklog(), live, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	select {
+	case utd := <-ran:
+		assert.Equal(t, "test://live", utd)
+	case <-time.After(time.Second * 5):
+		t.Fatal("Timed out waiting for task")
+	}
+	assert.Len(t, ran, 0)
+}
+
+func TestConcurrency(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, q := newTestExecutor(t, WithConcurrency(4))
+	var running, peak int32
+	release := make(chan struct{})
+	work := tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		<-release
+		return tasks.Result{}, nil
+	})
+	w.Add("test://defer/{id}", work).Concurrency(tasks.ConcurrencyPolicy{Limit: 1, Delay: time.Millisecond * 50})
+	hold := make(chan struct{})
+	w.Add("test://held/{id}", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		<-hold
+		return tasks.Result{}, nil
+	})).Concurrency(tasks.ConcurrencyPolicy{Limit: 1, Mode: tasks.Coalesce})
+	go w.Run(cxt)
+
+	// tasks with the same identity are deferred until the first completes;
+	// query parameters are not part of the key
+	first := transport.New("test://defer/1?n=1")
+	assert.NoError(t, q.Publish(cxt, first))
+	await(t, q.Worklog(), first, func(e *worklog.Entry) bool { return e.State == worklog.Running })
+	second := transport.New("test://defer/1?n=2")
+	assert.NoError(t, q.Publish(cxt, second))
+	// the deferred task's entry expires when it is due, so it is not stranded
+	// should this node stop
+	await(t, q.Worklog(), second, func(e *worklog.Entry) bool {
+		return e.TaskSeq > 1 && e.State == worklog.Pending && e.Expires != nil
+	})
+
+	close(release)
+	await(t, q.Worklog(), first, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	await(t, q.Worklog(), second, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peak))
+
+	// a task which is coalesced is resolved without running
+	first = transport.New("test://held/1")
+	assert.NoError(t, q.Publish(cxt, first))
+	await(t, q.Worklog(), first, func(e *worklog.Entry) bool { return e.State == worklog.Running })
+	second = transport.New("test://held/1")
+	assert.NoError(t, q.Publish(cxt, second))
+	await(t, q.Worklog(), second, func(e *worklog.Entry) bool { return e.State == worklog.Canceled })
+	close(hold)
+	await(t, q.Worklog(), first, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+}
+
+func TestMetrics(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m, err := metrics.New(metrics.Config{Namespace: "test", System: "exec"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w, q := newTestExecutor(t, WithMetrics(m))
+	w.Add("test://ok/{id}", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	}))
+	w.Add("test://broken", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, errors.New("Never works")
+	}))
+	go w.Run(cxt)
+
+	for _, utd := range []string{"test://ok/1", "test://ok/2", "test://broken"} {
+		msg := transport.NewWithId(ident.New(), utd)
+		assert.NoError(t, q.Publish(cxt, msg))
+		await(t, q.Worklog(), msg, func(e *worklog.Entry) bool { return e.Resolved() })
+	}
+	assert.NoError(t, q.Queue.Publish(&queue.Message{Data: []byte("not a task")}))
+
+	// counters are labeled by route pattern and task type
+	value := func(name string, labels map[string]string) float64 {
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		for _, f := range mfs {
+			if f.GetName() != name {
+				continue
+			}
+		outer:
+			for _, e := range f.GetMetric() {
+				for _, l := range e.GetLabel() {
+					if labels[l.GetName()] != l.GetValue() {
+						continue outer
+					}
+				}
+				return e.GetCounter().GetValue()
+			}
+		}
+		return 0
+	}
+	managed := string(transport.Managed)
+	assert.Eventually(t, func() bool {
+		return value("test_exec_task_malformed", nil) == 1
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, float64(3), value("test_exec_task_received", map[string]string{"type": managed}))
+	assert.Equal(t, float64(2), value("test_exec_task_success", map[string]string{"route": "test://ok/{id}", "type": managed}))
+	assert.Equal(t, float64(1), value("test_exec_task_failure", map[string]string{"route": "test://broken", "type": managed}))
+}
+
+func TestTracing(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exp := tracingtest.Install(t)
+	w, q := newTestExecutor(t)
+	w.Add("test://traced/{id}", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	// a task published within a trace, which triggers another when it completes
+	pcxt, parent := tracing.Start(cxt, "test.publish")
+	msg := transport.NewWithId(ident.New(), "test://traced/1").AddTrigger(worklog.Complete, "test://traced/2")
+	assert.NoError(t, q.Publish(pcxt, msg))
+	parent.End()
+	await(t, q.Worklog(), msg, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+
+	// the task's execution and the execution of the task it triggered both
+	// continue the trace of the original publication
+	traceId := parent.SpanContext().TraceID()
+	assert.Eventually(t, func() bool {
+		return len(tracingtest.Find(exp, "tasks.exec")) == 2 && len(tracingtest.Find(exp, "tasks.process")) == 2
+	}, time.Second*5, time.Millisecond*10)
+	for _, name := range []string{"tasks.publish", "tasks.process", "tasks.exec", "worklog.CreateEntry", "worklog.StoreEntry"} {
+		spans := tracingtest.Find(exp, name)
+		if assert.NotEmpty(t, spans, name) {
+			for _, e := range spans {
+				assert.Equal(t, traceId, e.SpanContext.TraceID(), name)
+			}
+		}
+	}
+
+	var states []string
+	for _, e := range tracingtest.Find(exp, "tasks.process") {
+		for _, a := range e.Attributes {
+			if a.Key == tracing.AttrState {
+				states = append(states, a.Value.AsString())
+			}
+		}
+	}
+	assert.Equal(t, []string{"complete", "complete"}, states)
+}
+
+func TestTracingRetry(t *testing.T) {
+	cxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exp := tracingtest.Install(t)
+	w, q := newTestExecutor(t, WithRetryPolicy(tasks.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	var attempts int32
+	w.Add("test://flaky", tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		if atomic.AddInt32(&attempts, 1) < 2 {
+			return tasks.Result{}, tasks.NewRecoverable(errors.New("Try again"))
+		}
+		return tasks.Result{}, nil
+	}))
+	go w.Run(cxt)
+
+	pcxt, parent := tracing.Start(cxt, "test.publish")
+	msg := transport.NewWithId(ident.New(), "test://flaky")
+	assert.NoError(t, q.Publish(pcxt, msg))
+	parent.End()
+	await(t, q.Worklog(), msg, func(e *worklog.Entry) bool { return e.State == worklog.Complete })
+
+	// the retry continues the trace of the original publication
+	traceId := parent.SpanContext().TraceID()
+	assert.Eventually(t, func() bool {
+		return len(tracingtest.Find(exp, "tasks.exec")) == 2
+	}, time.Second*5, time.Millisecond*10)
+	for _, name := range []string{"tasks.publish", "tasks.exec"} {
+		for _, e := range tracingtest.Find(exp, name) {
+			assert.Equal(t, traceId, e.SpanContext.TraceID(), name)
+		}
+	}
+	assert.Len(t, tracingtest.Find(exp, "tasks.publish"), 2)
+}
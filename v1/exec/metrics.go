@@ -0,0 +1,122 @@
+package exec
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/bww/go-tasks/v1/transport"
+
+	"github.com/bww/go-metrics/v1"
+)
+
+const (
+	labelRoute = "route"
+	labelType  = "type"
+	noRoute    = "none" // the route label for tasks which no route handles
+)
+
+// execMetrics holds the metrics reported by an executor. Task metrics are
+// labeled by the pattern of the route which handles the task and by the task
+// type. Every method is a no-op on a nil receiver, which is what an executor
+// has if it was not configured with metrics.
+type execMetrics struct {
+	received     metrics.CounterVec
+	malformed    metrics.Counter
+	success      metrics.CounterVec
+	failure      metrics.CounterVec
+	expired      metrics.CounterVec
+	retried      metrics.CounterVec
+	renewed      metrics.Counter
+	renewFailure metrics.Counter
+	inflight     metrics.Gauge
+	saturation   metrics.Gauge
+	exec         metrics.SamplerVec
+}
+
+func newExecMetrics(m *metrics.Metrics) *execMetrics {
+	if m == nil {
+		return nil
+	}
+	task := []string{labelRoute, labelType}
+	return &execMetrics{
+		received:     m.RegisterCounterVec("task_received", "Tasks received", []string{labelType}),
+		malformed:    m.RegisterCounter("task_malformed", "Messages which could not be parsed", nil),
+		success:      m.RegisterCounterVec("task_success", "Successful tasks", task),
+		failure:      m.RegisterCounterVec("task_failure", "Failed tasks", task),
+		expired:      m.RegisterCounterVec("task_expired", "Expired tasks", task),
+		retried:      m.RegisterCounterVec("task_retry", "Retries scheduled for failed tasks", task),
+		renewed:      m.RegisterCounter("lease_renewal", "Leases renewed for running tasks", nil),
+		renewFailure: m.RegisterCounter("lease_renewal_failure", "Leases which could not be renewed", nil),
+		inflight:     m.RegisterGauge("task_inflight", "Tasks in flight", nil),
+		saturation:   m.RegisterGauge("task_saturation", "Fraction of the concurrency limit in use", nil),
+		exec:         m.RegisterSamplerVec("task_exec", "Task execution duration", task),
+	}
+}
+
+func (m *execMetrics) taskReceived(msg *transport.Message) {
+	if m != nil {
+		m.received.With(metrics.Tags{labelType: string(msg.Type)}).Inc()
+	}
+}
+
+func (m *execMetrics) taskMalformed() {
+	if m != nil {
+		m.malformed.Inc()
+	}
+}
+
+func (m *execMetrics) taskFinished(route string, msg *transport.Message, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	tags := metrics.Tags{labelRoute: route, labelType: string(msg.Type)}
+	m.exec.With(tags).Observe(float64(d))
+	if err != nil {
+		m.failure.With(tags).Inc()
+	} else {
+		m.success.With(tags).Inc()
+	}
+}
+
+func (m *execMetrics) taskExpired(route string, msg *transport.Message) {
+	if m != nil {
+		m.expired.With(metrics.Tags{labelRoute: route, labelType: string(msg.Type)}).Inc()
+	}
+}
+
+func (m *execMetrics) taskRetried(route string, msg *transport.Message) {
+	if m != nil {
+		m.retried.With(metrics.Tags{labelRoute: route, labelType: string(msg.Type)}).Inc()
+	}
+}
+
+func (m *execMetrics) leaseRenewed(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.renewFailure.Inc()
+	} else {
+		m.renewed.Inc()
+	}
+}
+
+// inflightChanged reports the number of tasks in flight and how much of the
+// concurrency limit, cn, they occupy
+func (m *execMetrics) inflightChanged(n int64, cn int) {
+	if m != nil {
+		m.inflight.Set(float64(n))
+		m.saturation.Set(float64(n) / float64(cn))
+	}
+}
+
+// route produces the pattern of the route which handles a message, for use
+// as a metric label
+func (w *Executor) route(msg *transport.Message) string {
+	if u, err := url.Parse(msg.UTD); err == nil {
+		if r, _, err := w.Router.Find(u); err == nil && r != nil {
+			return r.String()
+		}
+	}
+	return noRoute
+}
@@ -0,0 +1,149 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-alert/v1"
+	"github.com/bww/go-ident/v1"
+)
+
+// retrySpec describes a retry, or another deferred task, which has been
+// scheduled but not yet published. A spec which is durable is also recorded
+// in the worklog as a Pending entry which expires when it is due, so the
+// promoter publishes it should this node stop before it does.
+type retrySpec struct {
+	timer    *time.Timer
+	message  *transport.Message
+	stateSeq int64
+	durable  bool
+}
+
+// retryPolicy obtains the retry policy for a message; the policy of the route
+// which handles the message is used if it defines one, otherwise we use the
+// executor's default policy.
+func (w *Executor) retryPolicy(msg *transport.Message) tasks.RetryPolicy {
+	if u, err := url.Parse(msg.UTD); err == nil {
+		if r, _, err := w.Router.Find(u); err == nil && r != nil {
+			if p, ok := r.RetryPolicy(); ok {
+				return p
+			}
+		}
+	}
+	return w.retry
+}
+
+// retryEntry produces the entry which records that a task which failed will
+// be retried at the provided time. The task returns to Pending, with the
+// number of retries recorded in the attribute worklog.AttrRetries, and the
+// entry expires when the retry is due. The trace context of the attempt which
+// failed is recorded on the entry, so that the retry continues its trace.
+func retryEntry(cxt context.Context, msg *transport.Message, ent *worklog.Entry, retries int, due time.Time) *worklog.Entry {
+	attempt := *msg
+	a := maps.Clone(attempt.SetTraceContext(cxt).Attrs)
+	if a == nil {
+		a = make(attrs.Attributes)
+	}
+	a.SetInt(worklog.AttrRetries, retries)
+	return ent.Next(worklog.Pending, msg.Data, worklog.WithAttributes(a), worklog.WithTriggers(msg.Triggers)).SetRetry(true).SetExpires(due)
+}
+
+// scheduleRetry publishes a new attempt for a task which failed once it is
+// due. The provided entry is the Pending entry produced by retryEntry, which
+// has already been stored.
+func (w *Executor) scheduleRetry(msg *transport.Message, ent *worklog.Entry, retries int) {
+	delay := time.Until(*ent.Expires)
+	w.scheduleEntry(ent, delay)
+	w.metrics.taskRetried(w.route(msg), msg)
+
+	if w.Verbose() {
+		msgLog(w.log, msg).Info("Scheduled retry", "retries", retries, "delay", delay)
+	}
+}
+
+// scheduleEntry publishes the task described by a stored Pending entry after
+// the provided delay. The entry must expire when the delay elapses, so that
+// the promoter publishes the task instead if this node stops first; whichever
+// publishes it first appends to the task's log and the other is dropped.
+func (w *Executor) scheduleEntry(ent *worklog.Entry, delay time.Duration) {
+	taskId := ent.TaskId.String()
+	w.retries.Set(taskId, retrySpec{
+		timer: time.AfterFunc(delay, func() {
+			if spec, ok := w.retries.Pop(taskId); ok {
+				w.publishRetry(spec)
+			}
+		}),
+		message:  transport.NewWithEntry(ent), // publishing with a sequence appends to the existing log
+		stateSeq: ent.StateSeq,                // pending → pending
+		durable:  true,
+	})
+}
+
+func (w *Executor) publishRetry(spec retrySpec) {
+	cxt, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	err := w.queue.Publish(cxt, spec.message, tasks.WithStateSeq(spec.stateSeq))
+	if errors.Is(err, worklog.ErrConflict) {
+		msgLog(w.log, spec.message).Info("Task was updated before it could be retried; dropping retry")
+	} else if err != nil {
+		alert.Error(fmt.Errorf("Could not publish task retry: %w", err), alert.WithTags(msgTags(spec.message)))
+	}
+}
+
+// deferMessage holds a task which was delivered before it is due and which
+// cannot be parked in the worklog, and republishes it once it is. Like
+// retries, held tasks are republished immediately if the executor stops
+// gracefully; should it crash, they are lost.
+func (w *Executor) deferMessage(msg *transport.Message, delay time.Duration) {
+	if msg.Id == ident.Zero {
+		msg.Id = ident.New()
+	}
+	taskId := msg.Id.String()
+	w.retries.Set(taskId, retrySpec{
+		timer: time.AfterFunc(delay, func() {
+			if spec, ok := w.retries.Pop(taskId); ok {
+				w.publishRetry(spec)
+			}
+		}),
+		message: msg,
+	})
+	if w.Verbose() {
+		msgLog(w.log, msg).Info("Holding task which was delivered early", "delay", delay)
+	}
+}
+
+// deferContended holds a managed task which could not run because too many
+// tasks with the same concurrency key were already running, and publishes it
+// again once the delay has elapsed. The provided entry is the Pending entry
+// which superseded the task's running entry, which expires when the delay
+// elapses.
+func (w *Executor) deferContended(msg *transport.Message, ent *worklog.Entry, delay time.Duration) {
+	w.scheduleEntry(ent, delay)
+	if w.Verbose() {
+		msgLog(w.log, msg).Info("Deferred task which exceeds its concurrency limit", "concurrency_key", ent.ConcurrencyKey(), "delay", delay)
+	}
+}
+
+// flushRetries is invoked when the executor stops. Deferred tasks which are
+// durable are left for the promoter to publish when they are due; the others
+// are only held in memory, so they are published immediately in order that
+// they are not lost.
+func (w *Executor) flushRetries() {
+	for _, k := range w.retries.Keys() {
+		if spec, ok := w.retries.Pop(k); ok {
+			spec.timer.Stop()
+			if !spec.durable {
+				w.publishRetry(spec)
+			}
+		}
+	}
+}
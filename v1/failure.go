@@ -0,0 +1,71 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bww/go-tasks/v1/deadletter"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-queue/v1"
+)
+
+// Failure describes a task which has failed definitively and how that
+// failure is handled
+type Failure struct {
+	Cause        error       // why the task failed
+	DeadLetter   queue.Queue // if provided, the failed task is sent here
+	Node         string      // the node which failed the task
+	Subscription string      // the subscription the task was received from, if any
+}
+
+// Trigger submits the dependent task for the state of the entry a task
+// resolved with, if it has one.
+func (q *Queue) Trigger(cxt context.Context, msg *transport.Message, ent *worklog.Entry) error {
+	if run, enq, ok := msg.TriggerForState(ent.State); ok {
+		err := q.Submit(cxt, msg.Dependent(run, enq, ent))
+		if err != nil {
+			return fmt.Errorf("Could not enqueue dependent task for trigger: %v: %w", run, err)
+		}
+	}
+	return nil
+}
+
+// Fail handles a managed task which has failed definitively, once its Failed
+// entry has been recorded: the task's trigger for the Failed state is
+// submitted and the task is dead-lettered. This is the case whether the task
+// failed when it was executed or because it was abandoned more times than it
+// may be recovered.
+func (q *Queue) Fail(cxt context.Context, msg *transport.Message, ent *worklog.Entry, f Failure) error {
+	var errs []error
+	if err := q.Trigger(cxt, msg, ent); err != nil {
+		errs = append(errs, err)
+	}
+	if f.DeadLetter != nil {
+		if err := deadLetter(msg, f); err != nil {
+			errs = append(errs, fmt.Errorf("Could not dead-letter failed task: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func deadLetter(msg *transport.Message, f Failure) error {
+	raw, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	var cause string
+	if f.Cause != nil {
+		cause = f.Cause.Error()
+	}
+	return deadletter.Publish(f.DeadLetter, raw, deadletter.Metadata{
+		Reason:       deadletter.Failed,
+		Error:        cause,
+		Node:         f.Node,
+		Subscription: f.Subscription,
+		Time:         time.Now(),
+	})
+}
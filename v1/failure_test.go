@@ -0,0 +1,48 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFail(t *testing.T) {
+	cxt := context.Background()
+	tq, dlq := queuetest.New(), queuetest.New()
+	q := NewQueue(tq, nil)
+
+	msg := transport.NewWithId(ident.New(), "test://a").AddTrigger(worklog.Failed, "test://failed").AddTrigger(worklog.Complete, "test://complete")
+	ent := msg.Entry(worklog.Failed, time.Now())
+
+	// the trigger for the Failed state is submitted and the task is
+	// dead-lettered
+	err := q.Fail(cxt, msg, ent, Failure{Cause: errors.New("Oops"), DeadLetter: dlq, Node: "test"})
+	assert.NoError(t, err)
+	if assert.Len(t, tq.Published(), 1) {
+		dep, err := transport.Parse(tq.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, "test://failed", dep.UTD)
+			assert.Equal(t, msg.Id.String(), dep.Attrs[worklog.AttrParentId])
+		}
+	}
+	if assert.Len(t, dlq.Published(), 1) {
+		dead, err := transport.Parse(dlq.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, msg.Id, dead.Id)
+		}
+	}
+
+	// without a dead-letter queue, only the trigger is submitted
+	err = q.Fail(cxt, msg, ent, Failure{Cause: errors.New("Oops")})
+	assert.NoError(t, err)
+	assert.Len(t, tq.Published(), 2)
+	assert.Len(t, dlq.Published(), 1)
+}
@@ -0,0 +1,127 @@
+// Package queuetest provides a simple, in-memory queue for tests.
+package queuetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bww/go-queue/v1"
+)
+
+// Queue records every message published to it and delivers them, in order,
+// to its consumers. The zero value is ready to use.
+type Queue struct {
+	mutex     sync.Mutex
+	err       error
+	published []*queue.Message
+	pending   []*queue.Message
+	notify    chan struct{}
+}
+
+// New creates a queue
+func New() *Queue {
+	return &Queue{}
+}
+
+// SetError sets the error publishing fails with; a nil error allows messages
+// to be published again
+func (q *Queue) SetError(err error) *Queue {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.err = err
+	return q
+}
+
+// Published produces every message which has been published to the queue, in
+// the order they were published
+func (q *Queue) Published() []*queue.Message {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]*queue.Message(nil), q.published...)
+}
+
+func (q *Queue) Publish(m *queue.Message) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+	q.published = append(q.published, m)
+	q.enqueue(m)
+	return nil
+}
+
+// enqueue adds a message to be delivered and wakes any waiting consumers;
+// the queue must be locked
+func (q *Queue) enqueue(m *queue.Message) {
+	q.pending = append(q.pending, m)
+	if q.notify != nil {
+		close(q.notify)
+		q.notify = nil
+	}
+}
+
+func (q *Queue) Consumer(name string) (queue.Consumer, error) {
+	return q, nil
+}
+
+func (q *Queue) Receive() (queue.Delivery, error) {
+	for {
+		d, wait := q.next()
+		if d != nil {
+			return d, nil
+		}
+		<-wait
+	}
+}
+
+func (q *Queue) ReceiveWithTimeout(timeout time.Duration) (queue.Delivery, error) {
+	deadline := time.After(timeout)
+	for {
+		d, wait := q.next()
+		if d != nil {
+			return d, nil
+		}
+		select {
+		case <-wait:
+		case <-deadline:
+			return nil, queue.ErrTimeout
+		}
+	}
+}
+
+// next produces the next pending delivery or, if there is none, a channel
+// which is closed when a message is next published
+func (q *Queue) next() (queue.Delivery, <-chan struct{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.pending) > 0 {
+		m := q.pending[0]
+		q.pending = q.pending[1:]
+		return delivery{q, m}, nil
+	}
+	if q.notify == nil {
+		q.notify = make(chan struct{})
+	}
+	return nil, q.notify
+}
+
+func (q *Queue) Close() error {
+	return nil
+}
+
+// delivery is a message received from a queue; it is returned to the queue
+// to be delivered again if it is not acknowledged
+type delivery struct {
+	q *Queue
+	m *queue.Message
+}
+
+func (d delivery) Message() *queue.Message { return d.m }
+func (d delivery) Ack()                    {}
+
+func (d delivery) Nack() {
+	d.q.mutex.Lock()
+	defer d.q.mutex.Unlock()
+	d.q.enqueue(d.m)
+}
@@ -0,0 +1,45 @@
+package promoter
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+)
+
+type Config struct {
+	Queue    *tasks.Queue
+	Interval time.Duration // how often do we check for tasks which are due?
+	Logger   *slog.Logger
+	Verbose  bool
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+func WithInterval(v time.Duration) Option {
+	return func(c Config) Config {
+		c.Interval = v
+		return c
+	}
+}
+
+func WithLogger(v *slog.Logger) Option {
+	return func(c Config) Config {
+		c.Logger = v
+		return c
+	}
+}
+
+func WithVerbose(v bool) Option {
+	return func(c Config) Config {
+		c.Verbose = v
+		return c
+	}
+}
@@ -0,0 +1,137 @@
+// Package promoter enqueues managed tasks which were deferred until a
+// not-before time once they are due. A deferred task is parked in the
+// worklog as Pending with an entry that expires when the task is due; the
+// promoter finds these entries and publishes the tasks to the queue.
+//
+// Retries of failed tasks are parked in the same way. The executor which
+// schedules a retry normally publishes it itself when it is due; the
+// promoter publishes it instead if that executor stops first.
+//
+// Any number of nodes may run a promoter. Promoting a task appends to its
+// log, so if more than one node attempts to promote the same task only the
+// first succeeds.
+package promoter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/tracing"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-alert/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+var (
+	ErrStopped       = errors.New("Not running")
+	ErrInvalidConfig = errors.New("Invalid configuration")
+)
+
+// the default interval between checks; this bounds how late a deferred task
+// may be enqueued
+const defaultInterval = time.Second * 10
+
+type Promoter struct {
+	queue   *tasks.Queue
+	worklog worklog.Worklog
+	ival    time.Duration
+	log     *slog.Logger
+	verbose bool
+}
+
+func New(q *tasks.Queue, opts ...Option) (*Promoter, error) {
+	return NewWithConfig(Config{
+		Queue: q,
+	}.WithOptions(opts))
+}
+
+func NewWithConfig(conf Config) (*Promoter, error) {
+	if conf.Queue == nil {
+		return nil, fmt.Errorf("%w: No queue provided", ErrInvalidConfig)
+	}
+	if conf.Queue.Worklog() == nil {
+		return nil, fmt.Errorf("%w: Queue has no worklog", ErrInvalidConfig)
+	}
+	if conf.Logger == nil {
+		conf.Logger = slog.Default()
+	}
+	ival := conf.Interval
+	if ival <= 0 {
+		ival = defaultInterval
+	}
+	return &Promoter{
+		queue:   conf.Queue,
+		worklog: tracing.Worklog(conf.Queue.Worklog()),
+		ival:    ival,
+		log:     conf.Logger.With("system", "promoter"),
+		verbose: conf.Verbose,
+	}, nil
+}
+
+// Run promotes tasks which are due at the configured interval until the
+// context is canceled.
+func (p *Promoter) Run(cxt context.Context) error {
+	for {
+		n, err := p.Promote(cxt, time.Now())
+		if err != nil {
+			alert.Error(fmt.Errorf("Could not promote deferred tasks: %w", err))
+		} else if n > 0 || p.verbose {
+			p.log.Info("Promoted deferred tasks", "count", n)
+		}
+		select {
+		case <-cxt.Done():
+			return ErrStopped
+		case <-time.After(p.ival):
+			// next pass
+		}
+	}
+}
+
+// Promote performs a single pass over the worklog, enqueuing every deferred
+// task which is due as of the provided time. It returns the number of tasks
+// which were promoted by this pass.
+func (p *Promoter) Promote(cxt context.Context, now time.Time) (int, error) {
+	it, err := p.worklog.IterLatestEntryForEveryTask(cxt, worklog.Criteria{Expired: true, States: []worklog.State{worklog.Pending}}, now)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+
+	var n int
+	for {
+		ent, err := it.Next()
+		if siter.IsFinished(err) {
+			break
+		} else if err != nil {
+			return n, err
+		}
+		ok, err := p.promote(cxt, ent)
+		if err != nil {
+			alert.Error(fmt.Errorf("Could not promote deferred task: %w", err), alert.WithTags(alert.Tags{"utd": ent.UTD, "worklog": ent.String()}))
+		} else if ok {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (p *Promoter) promote(cxt context.Context, ent *worklog.Entry) (bool, error) {
+	// the task remains Pending, but its new entry does not expire
+	err := p.queue.Publish(cxt, transport.NewWithEntry(ent), tasks.WithStateSeq(ent.StateSeq))
+	if errors.Is(err, worklog.ErrConflict) {
+		return false, nil // the task was updated since we fetched it; someone else has dealt with it
+	} else if err != nil {
+		return false, err
+	}
+	if p.verbose {
+		p.log.Info("Promoted deferred task", "utd", ent.UTD, "worklog", ent.String())
+	}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package promoter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromote(t *testing.T) {
+	cxt := context.Background()
+	now := time.Now()
+	wl := memory.New()
+	tq := queuetest.New()
+	q := tasks.NewQueue(tq, wl)
+
+	p, err := New(q)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	soon := transport.New("test://soon").SetData([]byte("data")).AddTrigger(worklog.Complete, "test://next")
+	assert.NoError(t, q.Publish(cxt, soon, tasks.WithRunAt(now.Add(time.Minute))))
+	later := transport.New("test://later")
+	assert.NoError(t, q.Publish(cxt, later, tasks.WithDelay(time.Hour)))
+	// deferred tasks are parked, not enqueued
+	assert.Len(t, tq.Published(), 0)
+
+	ent, err := wl.FetchLatestEntryForTask(cxt, soon.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Pending, ent.State)
+		assert.True(t, ent.Expires.Equal(now.Add(time.Minute)))
+	}
+
+	// nothing is due yet
+	n, err := p.Promote(cxt, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = p.Promote(cxt, now.Add(time.Minute*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	if assert.Len(t, tq.Published(), 1) {
+		msg, err := transport.Parse(tq.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, soon.Id, msg.Id)
+			assert.Equal(t, []byte("data"), msg.Data)
+			assert.Equal(t, soon.Triggers, msg.Triggers)
+			assert.True(t, msg.Due(now))
+		}
+	}
+	ent, err = wl.FetchLatestEntryForTask(cxt, soon.Id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Pending, ent.State)
+		assert.Equal(t, int64(1), ent.TaskSeq)
+		assert.Nil(t, ent.Expires)
+	}
+
+	// a promoted task is not promoted again
+	n, err = p.Promote(cxt, now.Add(time.Minute*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
@@ -2,15 +2,25 @@ package tasks
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"maps"
 	"time"
 
+	"github.com/bww/go-tasks/v1/tracing"
 	"github.com/bww/go-tasks/v1/transport"
 	"github.com/bww/go-tasks/v1/worklog"
 
 	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
 	"github.com/bww/go-queue/v1"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// the number of times we attempt to record a cancellation when the task is
+// being updated concurrently
+const maxCancelAttempts = 3
+
 type Delivery struct {
 	d   queue.Delivery
 	m   *transport.Message
@@ -25,6 +35,16 @@ func (d Delivery) Message() (*transport.Message, error) {
 	}
 }
 
+// Raw obtains the message as it was received from the underlying queue,
+// which is available even if the message could not be parsed.
+func (d Delivery) Raw() *queue.Message {
+	if d.d != nil {
+		return d.d.Message()
+	} else {
+		return nil
+	}
+}
+
 func (d Delivery) Ack() {
 	if d.d != nil {
 		d.d.Ack()
@@ -49,11 +69,14 @@ type Queue struct {
 }
 
 func NewQueue(q queue.Queue, w worklog.Worklog) *Queue {
-	return &Queue{q, w}
+	return &Queue{q, tracing.Worklog(w)}
 }
 
+// Worklog obtains the worklog the queue was created with, if any. The queue
+// traces its own operations on the worklog, but the worklog produced is the
+// one which was provided, not a traced wrapper.
 func (q *Queue) Worklog() worklog.Worklog {
-	return q.log
+	return tracing.Unwrap(q.log)
 }
 
 // Submit conforms to Publisher; it has the same effect as Publish in Queue
@@ -61,19 +84,74 @@ func (q *Queue) Submit(cxt context.Context, msg *transport.Message, opts ...Publ
 	return q.Publish(cxt, msg, opts...)
 }
 
+// Publish enqueues a task. Managed tasks are recorded in the worklog as
+// Pending before they are enqueued.
+//
+// A task which is published with a not-before time in the future and which
+// is managed is parked in the worklog instead of being enqueued: its Pending
+// entry expires when it is due, at which point a promoter enqueues it; see
+// [github.com/bww/go-tasks/v1/promoter]. Other tasks are enqueued
+// immediately and held by the executor which receives them until they are
+// due. Held tasks exist only in the memory of that executor, so they are
+// lost if it crashes before they are due.
+//
+// A managed task which is published with an idempotency key is not
+// published if another task with the same key is pending or running; the
+// message is instead assigned the identifier of that task. This suppresses
+// duplicates which result from retrying a submission, but it is not a lock:
+// tasks published concurrently with the same key may both be published.
+//
+// The trace context of cxt is recorded on the message, so that its execution
+// continues the same trace. If cxt has no trace context but the message
+// does, as is the case when a task is republished, the message's trace is
+// continued instead.
 func (q *Queue) Publish(cxt context.Context, msg *transport.Message, opts ...PublishOption) error {
+	if !trace.SpanContextFromContext(cxt).IsValid() {
+		cxt = msg.TraceContext(cxt) // e.g., a retry or a recovered task, which continues the trace it was published in
+	}
+	cxt, span := tracing.Start(cxt, "tasks.publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		tracing.AttrUTD.String(msg.UTD),
+		tracing.AttrType.String(string(msg.Type)),
+	))
+	err := q.publish(cxt, msg, opts...)
+	span.SetAttributes(tracing.AttrTaskId.String(msg.Id.String()))
+	tracing.End(span, err)
+	return err
+}
+
+func (q *Queue) publish(cxt context.Context, msg *transport.Message, opts ...PublishOption) error {
 	conf := PublishConfig{
 		StateSeq: 0,
 	}.WithOptions(opts)
 
+	if conf.Key != "" {
+		msg.SetAttrs(maps.Clone(msg.Attrs)).SetAttr(worklog.AttrIdempotencyKey, conf.Key) // attributes may be shared, e.g., with a workflow
+		if msg.Type == transport.Managed && q.log != nil && msg.Seq == 0 {
+			ent, err := q.findByKey(cxt, conf.Key)
+			if err != nil {
+				return err
+			} else if ent != nil {
+				msg.Id = ent.TaskId
+				return nil // the task was already published
+			}
+		}
+	}
 	if msg.Id == ident.Zero {
 		msg.Id = ident.New()
 	}
+	if !conf.NotBefore.IsZero() {
+		msg.SetNotBefore(conf.NotBefore)
+	}
+	if !conf.ExpiresAt.IsZero() {
+		msg.SetExpiresAt(conf.ExpiresAt)
+	}
+	msg.SetTraceContext(cxt)
 	c, err := msg.Encode()
 	if err != nil {
 		return err
 	}
 
+	var park bool
 	if msg.Type == transport.Managed && q.log != nil {
 		ent := &worklog.Entry{
 			TaskId:   msg.Id,
@@ -83,8 +161,14 @@ func (q *Queue) Publish(cxt context.Context, msg *transport.Message, opts ...Pub
 			UTD:      msg.UTD,
 			Data:     msg.Data,
 			Attrs:    msg.Attrs,
+			Triggers: msg.Triggers,
+			Workflow: msg.Workflow,
 			Created:  time.Now(),
 		}
+		if !msg.Due(ent.Created) {
+			ent.SetExpires(*msg.NotBefore)
+			park = true
+		}
 		var err error
 		if ent.TaskSeq == 0 {
 			err = q.log.CreateEntry(cxt, ent)
@@ -95,10 +179,70 @@ func (q *Queue) Publish(cxt context.Context, msg *transport.Message, opts ...Pub
 			return err
 		}
 	}
+	if park {
+		return nil // the promoter enqueues the task when it is due
+	}
 
 	return q.Queue.Publish(c)
 }
 
+// findByKey produces the latest entry for a task which was published with
+// the provided idempotency key and is not yet resolved, if there is one
+func (q *Queue) findByKey(cxt context.Context, key string) (*worklog.Entry, error) {
+	it, err := q.log.IterLatestEntryForEveryTask(cxt, worklog.Criteria{
+		Key:    key,
+		States: []worklog.State{worklog.Pending, worklog.Running},
+	}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	ent, err := it.Next()
+	if siter.IsFinished(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ent, nil
+}
+
+// Cancel requests that a managed task be canceled wherever it is executing
+// in the cluster. The request is recorded by appending a Canceled entry to the
+// task's log: a pending task is skipped when it is received and a running
+// task is stopped by the node executing it once that node observes the
+// entry. Canceling a task which has already been resolved produces
+// worklog.ErrResolved.
+func (q *Queue) Cancel(cxt context.Context, id ident.Ident) (*worklog.Entry, error) {
+	if q.log == nil {
+		return nil, ErrNoWorklog
+	}
+	errdat, err := json.Marshal(struct {
+		Message string `json:"message"`
+	}{
+		Message: "Task was canceled",
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < maxCancelAttempts; i++ {
+		ent, err := q.log.FetchLatestEntryForTask(cxt, id)
+		if err != nil {
+			return nil, err
+		} else if ent.Resolved() {
+			return ent, worklog.ErrResolved
+		}
+		next := ent.Next(worklog.Canceled, ent.Data).SetRetry(false).SetError(errdat)
+		err = q.log.StoreEntry(cxt, next)
+		if errors.Is(err, worklog.ErrConflict) {
+			continue // the task was updated concurrently; try again
+		} else if err != nil {
+			return nil, err
+		}
+		return next, nil
+	}
+	return nil, worklog.ErrConflict
+}
+
 func (q *Queue) Consume(cxt context.Context, name string) (<-chan Delivery, error) {
 	c, err := q.Queue.Consumer(name)
 	if err != nil {
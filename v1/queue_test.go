@@ -0,0 +1,65 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	cxt := context.Background()
+	tq := queuetest.New()
+	q := NewQueue(tq, memory.New())
+
+	first := transport.New("test://a")
+	assert.NoError(t, q.Publish(cxt, first, WithIdempotencyKey("abc")))
+	assert.Len(t, tq.Published(), 1)
+
+	// a duplicate is not published and assumes the identifier of the original
+	dup := transport.New("test://a")
+	assert.NoError(t, q.Publish(cxt, dup, WithIdempotencyKey("abc")))
+	assert.Len(t, tq.Published(), 1)
+	assert.Equal(t, first.Id, dup.Id)
+
+	// other keys are unaffected
+	other := transport.New("test://a")
+	assert.NoError(t, q.Publish(cxt, other, WithIdempotencyKey("xyz")))
+	assert.Len(t, tq.Published(), 2)
+	assert.NotEqual(t, first.Id, other.Id)
+
+	// once the original is resolved the key may be used again
+	ent, err := q.Worklog().FetchLatestEntryForTask(cxt, first.Id)
+	if assert.NoError(t, err) {
+		assert.NoError(t, q.Worklog().StoreEntry(cxt, ent.Next(worklog.Complete, nil)))
+	}
+	again := transport.New("test://a")
+	assert.NoError(t, q.Publish(cxt, again, WithIdempotencyKey("abc")))
+	assert.Len(t, tq.Published(), 3)
+	assert.NotEqual(t, first.Id, again.Id)
+
+	// the key is not leaked into attributes shared with a workflow
+	wf := worklog.NewWorkflow().SetStep("a", worklog.Step{UTD: "test://a", Attrs: attrs.Attributes{"other": "value"}})
+	step := transport.NewStep(wf, "a")
+	assert.NoError(t, q.Publish(cxt, step, WithIdempotencyKey("step")))
+	assert.Equal(t, "step", step.Attrs[worklog.AttrIdempotencyKey])
+	assert.Equal(t, attrs.Attributes{"other": "value"}, wf.Steps["a"].Attrs)
+}
+
+func TestWorklog(t *testing.T) {
+	// the worklog produced is the one the queue was created with, not the
+	// traced wrapper the queue uses internally
+	wl := memory.New()
+	q := NewQueue(queuetest.New(), wl)
+	assert.Same(t, wl, q.Worklog())
+	_, ok := q.Worklog().(*memory.Worklog)
+	assert.True(t, ok)
+
+	assert.Nil(t, NewQueue(queuetest.New(), nil).Worklog())
+}
@@ -0,0 +1,71 @@
+package reaper
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+
+	"github.com/bww/go-queue/v1"
+)
+
+type Config struct {
+	Queue         *tasks.Queue
+	Interval      time.Duration // how often do we sweep for expired entries?
+	MaxRecoveries int           // how many times may a task be recovered before it is failed; zero is unlimited
+	DeadLetter    queue.Queue   // if provided, tasks which are failed because they exhausted their recoveries are sent here
+	Nodename      string        // the name of this node in the task cluster; by default we use the hostname
+	Logger        *slog.Logger
+	Verbose       bool
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+func WithInterval(v time.Duration) Option {
+	return func(c Config) Config {
+		c.Interval = v
+		return c
+	}
+}
+
+func WithMaxRecoveries(v int) Option {
+	return func(c Config) Config {
+		c.MaxRecoveries = v
+		return c
+	}
+}
+
+func WithDeadLetter(v queue.Queue) Option {
+	return func(c Config) Config {
+		c.DeadLetter = v
+		return c
+	}
+}
+
+func WithNodename(v string) Option {
+	return func(c Config) Config {
+		c.Nodename = v
+		return c
+	}
+}
+
+func WithLogger(v *slog.Logger) Option {
+	return func(c Config) Config {
+		c.Logger = v
+		return c
+	}
+}
+
+func WithVerbose(v bool) Option {
+	return func(c Config) Config {
+		c.Verbose = v
+		return c
+	}
+}
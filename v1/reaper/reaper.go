@@ -0,0 +1,203 @@
+// Package reaper recovers managed tasks which were abandoned by the node
+// executing them. A running task holds a lease in the worklog which the
+// executor renews for as long as the task is running; if the node dies, the
+// lease expires and the reaper returns the task to the queue.
+package reaper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/tracing"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-alert/v1"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/bww/go-queue/v1"
+)
+
+var (
+	ErrStopped       = errors.New("Not running")
+	ErrInvalidConfig = errors.New("Invalid configuration")
+)
+
+// the default interval between sweeps
+const defaultInterval = time.Minute
+
+type Reaper struct {
+	queue    *tasks.Queue
+	worklog  worklog.Worklog
+	ival     time.Duration
+	maxrec   int
+	dlq      queue.Queue
+	nodename string
+	log      *slog.Logger
+	verbose  bool
+}
+
+func New(q *tasks.Queue, opts ...Option) (*Reaper, error) {
+	return NewWithConfig(Config{
+		Queue: q,
+	}.WithOptions(opts))
+}
+
+func NewWithConfig(conf Config) (*Reaper, error) {
+	if conf.Queue == nil {
+		return nil, fmt.Errorf("%w: No queue provided", ErrInvalidConfig)
+	}
+	if conf.Queue.Worklog() == nil {
+		return nil, fmt.Errorf("%w: Queue has no worklog", ErrInvalidConfig)
+	}
+	if conf.Logger == nil {
+		conf.Logger = slog.Default()
+	}
+	ival := conf.Interval
+	if ival <= 0 {
+		ival = defaultInterval
+	}
+	nodename := conf.Nodename
+	if nodename == "" {
+		var err error
+		nodename, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("No node name provided and could not obtain host name: %w", err)
+		}
+	}
+	return &Reaper{
+		queue:    conf.Queue,
+		worklog:  tracing.Worklog(conf.Queue.Worklog()),
+		ival:     ival,
+		maxrec:   conf.MaxRecoveries,
+		dlq:      conf.DeadLetter,
+		nodename: nodename,
+		log:      conf.Logger.With("system", "reaper"),
+		verbose:  conf.Verbose,
+	}, nil
+}
+
+// Run sweeps the worklog for expired entries at the configured interval
+// until the context is canceled.
+func (r *Reaper) Run(cxt context.Context) error {
+	for {
+		n, err := r.Sweep(cxt, time.Now())
+		if err != nil {
+			alert.Error(fmt.Errorf("Could not sweep worklog: %w", err))
+		} else if n > 0 || r.verbose {
+			r.log.Info("Recovered expired tasks", "count", n)
+		}
+		select {
+		case <-cxt.Done():
+			return ErrStopped
+		case <-time.After(r.ival):
+			// next sweep
+		}
+	}
+}
+
+// Sweep performs a single pass over the worklog, recovering every task whose
+// latest entry has expired as of the provided time. It returns the number of
+// tasks which were recovered by this sweep.
+//
+// A recovered task transitions back to Pending, with its recovery count
+// recorded in the attribute worklog.AttrRecovered, and is republished to the
+// queue. If the task has already been recovered the maximum number of times
+// it transitions to Failed instead and, as with any task which fails
+// definitively, its trigger for the Failed state is submitted and it is sent
+// to the dead-letter queue, if one is configured.
+func (r *Reaper) Sweep(cxt context.Context, now time.Time) (int, error) {
+	// only running tasks hold a lease; a pending task which has expired was
+	// deferred and is now due, which is the promoter's concern
+	it, err := r.worklog.IterLatestEntryForEveryTask(cxt, worklog.Criteria{Expired: true, States: []worklog.State{worklog.Running}}, now)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+
+	var n int
+	for {
+		ent, err := it.Next()
+		if siter.IsFinished(err) {
+			break
+		} else if err != nil {
+			return n, err
+		}
+		ok, err := r.recover(cxt, ent)
+		if err != nil {
+			alert.Error(fmt.Errorf("Could not recover expired task: %w", err), alert.WithTags(alert.Tags{"utd": ent.UTD, "worklog": ent.String()}))
+		} else if ok {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (r *Reaper) recover(cxt context.Context, ent *worklog.Entry) (bool, error) {
+	log := r.log.With("utd", ent.UTD, "worklog", ent.String(), "expires", ent.Expires)
+
+	a := maps.Clone(ent.Attrs)
+	if a == nil {
+		a = make(attrs.Attributes)
+	}
+	n, _ := a.Int(worklog.AttrRecovered) // if the attribute is missing or malformed we start from zero
+	n++
+	a.SetInt(worklog.AttrRecovered, n)
+
+	var err error
+	if r.maxrec > 0 && n > r.maxrec {
+		log.Info("Task lease expired; recovery limit exceeded, failing task", "recovered", n-1)
+		return r.fail(cxt, ent, a, fmt.Errorf("Task lease expired after %d recoveries", n-1))
+	} else {
+		log.Info("Task lease expired; recovering task", "recovered", n)
+		msg := transport.NewWithEntry(ent).SetAttrs(a)
+		err = r.queue.Publish(cxt, msg, tasks.WithStateSeq(ent.StateSeq+1))
+	}
+	if errors.Is(err, worklog.ErrConflict) {
+		return false, nil // the task was updated since we fetched it; someone else has dealt with it
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// fail records a task which has exhausted its recoveries as Failed and then
+// handles its failure in the same way the executor handles any other task
+// which fails definitively
+func (r *Reaper) fail(cxt context.Context, ent *worklog.Entry, a attrs.Attributes, cause error) (bool, error) {
+	next := ent.Next(worklog.Failed, ent.Data, worklog.WithAttributes(a), worklog.WithTriggers(ent.Triggers)).SetRetry(false)
+	errdat, err := json.Marshal(struct {
+		Message string `json:"message"`
+	}{
+		Message: cause.Error(),
+	})
+	if err == nil {
+		next.SetError(errdat)
+	}
+	err = r.worklog.StoreEntry(cxt, next)
+	if errors.Is(err, worklog.ErrConflict) {
+		return false, nil // the task was updated since we fetched it; someone else has dealt with it
+	} else if err != nil {
+		return false, err
+	}
+
+	msg := transport.NewWithEntry(ent).SetAttrs(a)
+	err = r.queue.Fail(cxt, msg, next, tasks.Failure{
+		Cause:      cause,
+		DeadLetter: r.dlq,
+		Node:       r.nodename,
+	})
+	if err != nil {
+		alert.Error(fmt.Errorf("Could not handle failed task: %w", err), alert.WithTags(alert.Tags{"utd": ent.UTD, "worklog": next.String()}))
+	}
+	return true, nil
+}
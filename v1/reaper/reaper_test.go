@@ -0,0 +1,103 @@
+package reaper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/deadletter"
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/memory"
+
+	"github.com/bww/go-ident/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweep(t *testing.T) {
+	cxt := context.Background()
+	now := time.Now()
+	wl := memory.New()
+	tq, dlq := queuetest.New(), queuetest.New()
+
+	r, err := New(tasks.NewQueue(tq, wl), WithMaxRecoveries(2), WithDeadLetter(dlq), WithNodename("test"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	live := (&worklog.Entry{TaskId: ident.New(), TaskSeq: 1, State: worklog.Running, UTD: "test://live", Created: now}).SetExpires(now.Add(time.Minute))
+	dead := (&worklog.Entry{TaskId: ident.New(), TaskSeq: 1, State: worklog.Running, StateSeq: 1, UTD: "test://dead", Data: []byte("data"), Created: now}).SetExpires(now.Add(-time.Minute))
+	dead.Triggers = worklog.Triggers{worklog.Complete: {"test://next"}}
+	done := (&worklog.Entry{TaskId: ident.New(), TaskSeq: 1, State: worklog.Running, UTD: "test://done", Attrs: attrs.Attributes{worklog.AttrRecovered: "2"}, Created: now}).SetExpires(now.Add(-time.Minute))
+	done.Triggers = worklog.Triggers{worklog.Failed: {"test://failed"}}
+	for _, e := range []*worklog.Entry{live, dead, done} {
+		assert.NoError(t, wl.CreateEntry(cxt, e))
+	}
+
+	n, err := r.Sweep(cxt, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, n)
+	}
+
+	published := make(map[string]*transport.Message)
+	for _, e := range tq.Published() {
+		msg, err := transport.Parse(e)
+		if assert.NoError(t, err) {
+			published[msg.UTD] = msg
+		}
+	}
+	assert.Len(t, published, 2)
+
+	// the abandoned task is returned to the queue...
+	if msg, ok := published["test://dead"]; assert.True(t, ok) {
+		assert.Equal(t, dead.TaskId, msg.Id)
+		assert.Equal(t, int64(2), msg.Seq)
+		assert.Equal(t, dead.Data, msg.Data)
+		assert.Equal(t, dead.Triggers, msg.Triggers)
+	}
+	// ...and recorded as pending in the worklog
+	ent, err := wl.FetchLatestEntryForTask(cxt, dead.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Pending, ent.State)
+		assert.Equal(t, int64(2), ent.StateSeq)
+		assert.Equal(t, "1", ent.Attrs[worklog.AttrRecovered])
+	}
+	// the task which exhausted its recoveries is failed...
+	ent, err = wl.FetchLatestEntryForTask(cxt, done.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Failed, ent.State)
+		assert.NotEmpty(t, ent.Error)
+		assert.Equal(t, done.Triggers, ent.Triggers)
+	}
+	// ...its trigger for that state is submitted...
+	if msg, ok := published["test://failed"]; assert.True(t, ok) {
+		assert.Equal(t, done.TaskId.String(), msg.Attrs[worklog.AttrParentId])
+		assert.Equal(t, string(worklog.Failed), msg.Attrs[worklog.AttrParentState])
+	}
+	// ...and it is dead-lettered
+	if assert.Len(t, dlq.Published(), 1) {
+		raw := dlq.Published()[0]
+		assert.Equal(t, string(deadletter.Failed), raw.Attributes["dl_reason"])
+		assert.Equal(t, "test", raw.Attributes["dl_node"])
+		assert.Contains(t, raw.Attributes["dl_error"], "after 2 recoveries")
+		msg, err := transport.Parse(raw)
+		if assert.NoError(t, err) {
+			assert.Equal(t, done.TaskId, msg.Id)
+			assert.Equal(t, "test://done", msg.UTD)
+		}
+	}
+	// the live task is untouched
+	ent, err = wl.FetchLatestEntryForTask(cxt, live.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, live.TaskSeq, ent.TaskSeq)
+	}
+
+	// nothing remains to be recovered
+	n, err = r.Sweep(cxt, now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, n)
+	}
+}
@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMultiplier = 2
+)
+
+// RetryPolicy describes how a managed task which fails with a recoverable
+// error is retried. The zero value does not retry.
+type RetryPolicy struct {
+	MaxAttempts int           // the maximum number of attempts, including the first; zero or one disables retries
+	Backoff     time.Duration // the delay before the first retry; defaults to one second
+	MaxBackoff  time.Duration // the maximum delay between attempts; zero is unlimited
+	Multiplier  float64       // the factor by which the delay grows after each attempt; defaults to 2
+	Jitter      float64       // the fraction of each delay, in [0, 1], which is randomized
+}
+
+// Permits determines if the policy allows another attempt after the provided
+// number of retries have already been performed.
+func (p RetryPolicy) Permits(retries int) bool {
+	return retries+1 < p.MaxAttempts
+}
+
+// Delay produces the amount of time to wait before performing the provided
+// retry, counting from one. The delay grows exponentially with each retry and
+// is randomized by the jitter fraction, so that many tasks failing at once do
+// not all retry at once.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	base := p.Backoff
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = defaultRetryMultiplier
+	}
+	d := float64(base) * math.Pow(mult, float64(max(0, retry-1)))
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if j := min(1, max(0, p.Jitter)); j > 0 {
+		d -= d * j * rand.Float64()
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,27 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: time.Second * 3}
+	assert.True(t, p.Permits(0))
+	assert.True(t, p.Permits(1))
+	assert.False(t, p.Permits(2))
+	assert.False(t, RetryPolicy{}.Permits(0))
+
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, time.Second*2, p.Delay(2))
+	assert.Equal(t, time.Second*3, p.Delay(3)) // capped
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Delay(2)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.LessOrEqual(t, d, time.Second*2)
+	}
+}
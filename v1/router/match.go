@@ -0,0 +1,207 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bww/go-router/v1/path"
+)
+
+const (
+	wildOne   = "*"
+	wildMulti = "**"
+)
+
+// The rank of a component of a pattern; lower ranks are more specific and
+// take precedence over higher ones
+const (
+	rankLiteral = iota
+	rankVar
+	rankWildcard
+	rankMulti // a trailing '**', which matches any number of components
+)
+
+// matchAll describes the path of a route which matches every path
+var matchAll = []string{"", wildMulti}
+
+func isVar(c string) bool {
+	l := len(c)
+	return l > 2 && c[0] == '{' && c[l-1] == '}'
+}
+
+func hostRank(h string) int {
+	if h == wildcard {
+		return rankWildcard
+	} else if isVar(h) {
+		return rankVar
+	} else {
+		return rankLiteral
+	}
+}
+
+func pathRank(c string, last bool) int {
+	if c == wildMulti && last {
+		return rankMulti
+	} else if c == wildOne || c == wildMulti {
+		return rankWildcard
+	} else if isVar(c) {
+		return rankVar
+	} else {
+		return rankLiteral
+	}
+}
+
+func pathRanks(c []string) []int {
+	r := make([]int, len(c))
+	for i, e := range c {
+		r[i] = pathRank(e, i == len(c)-1)
+	}
+	return r
+}
+
+// components splits a path pattern into its components
+func components(p path.Path) []string {
+	s := p.String()
+	if s == wildcard {
+		return matchAll
+	} else if s == "" {
+		return nil
+	} else {
+		return strings.Split(s, "/")
+	}
+}
+
+// matchState records how specific the pattern which matched a UTD is
+type matchState struct {
+	host int   // the rank of the host
+	path []int // the ranks of each path component
+}
+
+func (s *matchState) set(host int, path []int) {
+	if s != nil {
+		s.host, s.path = host, path
+	}
+}
+
+// compare produces a negative number if s is more specific than v, a
+// positive number if it is less specific and zero if they are equivalent.
+// Hosts take precedence over paths, which are compared component-by-component
+// from left to right.
+func (s *matchState) compare(v *matchState) int {
+	if s.host != v.host {
+		return s.host - v.host
+	}
+	return compareRanks(s.path, v.path)
+}
+
+func compareRanks(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return len(a) - len(b) // a trailing '**' may match nothing
+}
+
+// overlaps determines if any path is matched by both patterns
+func overlaps(a, b []string) bool {
+	for ; len(a) > 0 && len(b) > 0; a, b = a[1:], b[1:] {
+		ra, rb := pathRank(a[0], len(a) == 1), pathRank(b[0], len(b) == 1)
+		if ra == rankMulti || rb == rankMulti {
+			return true
+		} else if ra == rankLiteral && rb == rankLiteral && a[0] != b[0] {
+			return false
+		}
+	}
+	if len(a) > 0 {
+		return pathRank(a[0], len(a) == 1) == rankMulti
+	} else if len(b) > 0 {
+		return pathRank(b[0], len(b) == 1) == rankMulti
+	} else {
+		return true
+	}
+}
+
+// covers determines if every path matched by b is also matched by a
+func covers(a, b []string) bool {
+	for ; len(a) > 0 && len(b) > 0; a, b = a[1:], b[1:] {
+		ra, rb := pathRank(a[0], len(a) == 1), pathRank(b[0], len(b) == 1)
+		if ra == rankMulti {
+			return true
+		} else if rb == rankMulti {
+			return false
+		} else if ra == rankLiteral && (rb != rankLiteral || a[0] != b[0]) {
+			return false
+		}
+	}
+	if len(a) > 0 {
+		return pathRank(a[0], len(a) == 1) == rankMulti
+	} else {
+		return len(b) == 0
+	}
+}
+
+// patterns produces the path patterns a route matches
+func (r *Route) patterns() [][]string {
+	if r.host == wildcard || len(r.paths) == 0 {
+		return [][]string{matchAll} // paths are not considered for wildcard hosts
+	}
+	p := make([][]string, len(r.paths))
+	for i, e := range r.paths {
+		p[i] = components(e)
+	}
+	return p
+}
+
+// conflict determines if the patterns of route a, which is being added, are
+// in conflict with those of route b, which was added before it. Routes
+// conflict when a UTD is matched by both and neither is more specific than
+// the other (they are ambiguous) or when they match the same UTDs, in which
+// case the one which takes precedence shadows the other (it is unreachable).
+func conflict(a *Route, ap [][]string, b *Route) error {
+	if !strings.EqualFold(a.scheme, b.scheme) {
+		return nil
+	}
+	if ha, hb := hostRank(a.host), hostRank(b.host); ha != hb {
+		return shadowed(a, ap, b) // the more specific host always takes precedence
+	} else if ha == rankLiteral && !strings.EqualFold(a.host, b.host) {
+		return nil // the routes match different hosts
+	}
+	for _, x := range ap {
+		for _, y := range b.patterns() {
+			if !overlaps(x, y) {
+				continue
+			}
+			cx, cy := covers(x, y), covers(y, x)
+			if cx && cy { // the routes match the same UTDs; the more specific or the earlier wins
+				if compareRanks(pathRanks(x), pathRanks(y)) < 0 {
+					return fmt.Errorf("%w: %v is shadowed by %v", ErrUnreachable, b, a)
+				} else {
+					return fmt.Errorf("%w: %v is shadowed by %v", ErrUnreachable, a, b)
+				}
+			} else if !cx && !cy {
+				return fmt.Errorf("%w: %v and %v match some of the same UTDs and neither is more specific", ErrAmbiguous, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// shadowed determines if a route with a wildcard host is unreachable because
+// a route with a variable host, which matches every host, also matches every
+// path. Routes with hosts of any other precedence never shadow one another.
+func shadowed(a *Route, ap [][]string, b *Route) error {
+	v, w, vp := a, b, ap
+	if hostRank(a.host) == rankWildcard {
+		v, w, vp = b, a, b.patterns()
+	}
+	if hostRank(v.host) != rankVar || hostRank(w.host) != rankWildcard {
+		return nil
+	}
+	for _, e := range vp {
+		if covers(e, matchAll) {
+			return fmt.Errorf("%w: %v is shadowed by %v", ErrUnreachable, w, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package middle provides standard middleware for tasks routed by
+// [github.com/bww/go-tasks/v1/router].
+package middle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/router"
+
+	"github.com/bww/go-metrics/v1"
+)
+
+var ErrPanic = errors.New("Task panicked")
+
+// Timeout cancels the context of a task once the provided duration has
+// elapsed. The task is responsible for observing its context.
+func Timeout(d time.Duration) router.Middleware {
+	return func(next tasks.Task) tasks.Task {
+		return tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+			cxt, cancel := context.WithTimeout(cxt, d)
+			defer cancel()
+			return next.Exec(cxt, req, params)
+		})
+	}
+}
+
+// Recover converts a panic in a task into an error which wraps ErrPanic and
+// includes the stack.
+func Recover() router.Middleware {
+	return func(next tasks.Task) tasks.Task {
+		return tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (res tasks.Result, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v\n%s", ErrPanic, r, string(debug.Stack()))
+				}
+			}()
+			return next.Exec(cxt, req, params)
+		})
+	}
+}
+
+// Logging logs every task once it finishes, with its duration and the error
+// it failed with, if any. If no logger is provided the default is used.
+func Logging(log *slog.Logger) router.Middleware {
+	if log == nil {
+		log = slog.Default()
+	}
+	return func(next tasks.Task) tasks.Task {
+		return tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+			start := time.Now()
+			res, err := next.Exec(cxt, req, params)
+			log := req.Logger(log).With("duration", time.Since(start))
+			if err != nil {
+				log.Error("Task failed", "cause", err)
+			} else {
+				log.Info("Task completed")
+			}
+			return res, err
+		})
+	}
+}
+
+// Metrics counts successful and failed tasks and samples their duration,
+// labeled by the scheme and host of the UTD. The metrics are registered with
+// the provided name as a prefix, which must therefore be unique. If no
+// metrics are provided the middleware does nothing.
+func Metrics(m *metrics.Metrics, name string) router.Middleware {
+	if m == nil {
+		return func(next tasks.Task) tasks.Task { return next }
+	}
+	labels := []string{"scheme", "host"}
+	var (
+		success = m.RegisterCounterVec(name+"_success", "Successful tasks", labels)
+		failure = m.RegisterCounterVec(name+"_failure", "Failed tasks", labels)
+		exec    = m.RegisterSamplerVec(name+"_duration", "Task execution duration", labels)
+	)
+	return func(next tasks.Task) tasks.Task {
+		return tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+			start := time.Now()
+			res, err := next.Exec(cxt, req, params)
+			tags := metrics.Tags{"scheme": req.UTD.Scheme, "host": req.UTD.Host}
+			exec.With(tags).Observe(float64(time.Since(start)))
+			if err != nil {
+				failure.With(tags).Inc()
+			} else {
+				success.With(tags).Inc()
+			}
+			return res, err
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+
+	"github.com/bww/go-metrics/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRequest(t *testing.T) *tasks.Request {
+	u, err := url.Parse("test://middle/a")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return tasks.NewRequest(u)
+}
+
+func TestTimeout(t *testing.T) {
+	task := Timeout(time.Millisecond * 10)(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		<-cxt.Done()
+		return tasks.Result{}, cxt.Err()
+	}))
+	_, err := task.Exec(context.Background(), testRequest(t), tasks.Params{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRecover(t *testing.T) {
+	task := Recover()(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		panic("oops")
+	}))
+	_, err := task.Exec(context.Background(), testRequest(t), tasks.Params{})
+	assert.ErrorIs(t, err, ErrPanic)
+	assert.Contains(t, err.Error(), "oops")
+
+	errFailed := errors.New("Failed")
+	task = Recover()(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, errFailed
+	}))
+	_, err = task.Exec(context.Background(), testRequest(t), tasks.Params{})
+	assert.Equal(t, errFailed, err)
+}
+
+func TestLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := slog.New(slog.NewTextHandler(buf, nil))
+
+	task := Logging(log)(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	}))
+	_, err := task.Exec(context.Background(), testRequest(t), tasks.Params{})
+	assert.NoError(t, err)
+	out := buf.String()
+	assert.Contains(t, out, "level=INFO")
+	assert.Contains(t, out, `msg="Task completed"`)
+	assert.Contains(t, out, "utd=test://middle/a")
+	assert.Contains(t, out, "duration=")
+
+	buf.Reset()
+	task = Logging(log)(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, errors.New("Never works")
+	}))
+	_, err = task.Exec(context.Background(), testRequest(t), tasks.Params{})
+	assert.Error(t, err)
+	out = buf.String()
+	assert.Contains(t, out, "level=ERROR")
+	assert.Contains(t, out, `msg="Task failed"`)
+	assert.Contains(t, out, `cause="Never works"`)
+}
+
+func TestMetrics(t *testing.T) {
+	m, err := metrics.New(metrics.Config{Namespace: "test", System: "middle"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	mw := Metrics(m, "route")
+	ok := mw(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, nil
+	}))
+	broken := mw(tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+		return tasks.Result{}, errors.New("Never works")
+	}))
+	for _, e := range []tasks.Task{ok, ok, broken} {
+		e.Exec(context.Background(), testRequest(t), tasks.Params{})
+	}
+
+	// the metrics are registered with the name as a prefix and labeled by the
+	// scheme and host of the UTD
+	labels := map[string]string{"scheme": "test", "host": "middle"}
+	count := func(name string) (uint64, bool) {
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		if !assert.NoError(t, err) {
+			return 0, false
+		}
+		for _, f := range mfs {
+			if f.GetName() != name || len(f.GetMetric()) != 1 {
+				continue
+			}
+			e := f.GetMetric()[0]
+			for _, l := range e.GetLabel() {
+				assert.Equal(t, labels[l.GetName()], l.GetValue(), name)
+			}
+			if c := e.GetCounter(); c != nil {
+				return uint64(c.GetValue()), true
+			} else {
+				return e.GetSummary().GetSampleCount(), true
+			}
+		}
+		return 0, false
+	}
+	for name, expect := range map[string]uint64{"test_middle_route_success": 2, "test_middle_route_failure": 1, "test_middle_route_duration": 3} {
+		n, found := count(name)
+		if assert.True(t, found, name) {
+			assert.Equal(t, expect, n, name)
+		}
+	}
+
+	// without metrics, the task is not wrapped
+	_, err = Metrics(nil, "none")(broken).Exec(context.Background(), testRequest(t), tasks.Params{})
+	assert.Error(t, err)
+}
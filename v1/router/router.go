@@ -2,11 +2,13 @@ package router
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
 
 	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/utds"
 
 	"github.com/bww/go-router/v1/path"
 )
@@ -16,6 +18,12 @@ const (
 	slashWildcard = "/*"
 )
 
+var (
+	ErrNoRoute     = errors.New("No such route")
+	ErrAmbiguous   = errors.New("Ambiguous route")
+	ErrUnreachable = errors.New("Unreachable route")
+)
+
 func mergeVars(a, b map[string]string) map[string]string {
 	if a == nil {
 		return b
@@ -28,16 +36,30 @@ func mergeVars(a, b map[string]string) map[string]string {
 	return a
 }
 
-type matchState struct {
-	// future use
+// Middleware wraps a task to produce another task, which typically does
+// something before or after invoking the one it wraps
+type Middleware func(tasks.Task) tasks.Task
+
+// chain wraps a task in the provided middleware; the first middleware is
+// outermost, so it is invoked first
+func chain(t tasks.Task, m []Middleware) tasks.Task {
+	for i := len(m) - 1; i >= 0; i-- {
+		t = m[i](t)
+	}
+	return t
 }
 
 // An individual route
 type Route struct {
+	router *router
+	name   string
 	task   tasks.Task
 	scheme string
 	host   string
 	paths  []path.Path
+	retry  *tasks.RetryPolicy
+	conc   *tasks.ConcurrencyPolicy
+	middle []Middleware
 }
 
 // Add paths
@@ -47,10 +69,64 @@ func (r *Route) Paths(s ...string) *Route {
 		p[i] = path.Parse(e)
 	}
 	r.paths = append(r.paths, p...)
+	if r.router != nil && r.host != wildcard {
+		c := make([][]string, len(p))
+		for i, e := range p {
+			c[i] = components(e)
+		}
+		r.router.check(r, c)
+	}
+	return r
+}
+
+// Name this route, so that UTDs it matches can be built by name; see
+// Router.URL
+func (r *Route) Name(n string) *Route {
+	r.name = n
+	return r
+}
+
+// Use adds middleware which wraps tasks handled by this route. Route
+// middleware is invoked after any middleware added to the router.
+func (r *Route) Use(m ...Middleware) *Route {
+	r.middle = append(r.middle, m...)
+	return r
+}
+
+// Set the retry policy for tasks handled by this route, overriding the
+// executor's default policy
+func (r *Route) Retry(p tasks.RetryPolicy) *Route {
+	r.retry = &p
+	return r
+}
+
+// Obtain the retry policy for this route, if one was set
+func (r *Route) RetryPolicy() (tasks.RetryPolicy, bool) {
+	if r.retry != nil {
+		return *r.retry, true
+	} else {
+		return tasks.RetryPolicy{}, false
+	}
+}
+
+// Set the concurrency policy for tasks handled by this route, which limits
+// how many tasks with the same key may run at once
+func (r *Route) Concurrency(p tasks.ConcurrencyPolicy) *Route {
+	r.conc = &p
 	return r
 }
 
-// Matches or not
+// Obtain the concurrency policy for this route, if one was set
+func (r *Route) ConcurrencyPolicy() (tasks.ConcurrencyPolicy, bool) {
+	if r.conc != nil {
+		return *r.conc, true
+	} else {
+		return tasks.ConcurrencyPolicy{}, false
+	}
+}
+
+// Matches or not. When the route matches, the state records how specific
+// the match is, so that the most specific route can be chosen.
 func (r Route) Matches(utd *url.URL, state *matchState) (bool, map[string]string) {
 	if !strings.EqualFold(r.scheme, utd.Scheme) {
 		return false, nil
@@ -58,6 +134,7 @@ func (r Route) Matches(utd *url.URL, state *matchState) (bool, map[string]string
 
 	var gvars map[string]string
 	if r.host == wildcard {
+		state.set(rankWildcard, pathRanks(matchAll))
 		return true, nil
 	} else if l := len(r.host); l > 2 && r.host[0] == '{' && r.host[l-1] == '}' {
 		gvars = map[string]string{strings.TrimSpace(string(r.host[1 : l-1])): utd.Host} // matches everything
@@ -65,23 +142,65 @@ func (r Route) Matches(utd *url.URL, state *matchState) (bool, map[string]string
 		return false, nil
 	}
 
+	hrank := hostRank(r.host)
 	if l := len(r.paths); l == 0 {
+		state.set(hrank, pathRanks(matchAll))
 		return true, gvars // no paths to match, we must succeed
 	}
+
+	var (
+		match bool
+		best  []int
+		vars  map[string]string
+	)
 	for _, e := range r.paths {
-		if e.String() == wildcard {
-			return true, nil
-		} else if ok, pvars := e.Matches(utd.Path); ok {
-			return true, mergeVars(gvars, pvars)
+		var pvars map[string]string
+		if e.String() != wildcard {
+			var ok bool
+			if ok, pvars = e.Matches(utd.Path); !ok {
+				continue
+			}
 		}
+		if ranks := pathRanks(components(e)); !match || compareRanks(ranks, best) < 0 {
+			match, best, vars = true, ranks, pvars
+		}
+	}
+	if !match {
+		return false, nil
 	}
 
-	return false, nil
+	state.set(hrank, best)
+	return true, mergeVars(gvars, vars)
+}
+
+// Pattern produces the pattern UTDs are built from for this route. When a
+// route has more than one path, the first one is used.
+func (r *Route) Pattern() string {
+	if r.host == wildcard {
+		return r.scheme + ":" + wildcard
+	}
+	b := strings.Builder{}
+	b.WriteString(r.scheme + ":")
+	if r.host != "" {
+		b.WriteString("//" + r.host)
+	}
+	if len(r.paths) == 0 {
+		b.WriteString(slashWildcard)
+	} else {
+		b.WriteString(r.paths[0].String())
+	}
+	return b.String()
+}
+
+// URL builds a UTD which is matched by this route from the provided
+// variables and query; see utds.Build
+func (r *Route) URL(vars path.Vars, query url.Values) (string, error) {
+	return utds.Build(r.Pattern(), vars, query)
 }
 
 // Handle the request
 func (r *Route) Exec(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
-	return r.task.Exec(cxt, req, params)
+	return chain(r.task, r.middle).Exec(cxt, req, params)
 }
 
 // Describe this route
@@ -113,13 +232,33 @@ func (r *Route) String() string {
 // Router
 type Router interface {
 	Add(string, tasks.Task) *Route
+	Use(...Middleware)
 	Find(*url.URL) (*Route, path.Vars, error)
+	URL(string, path.Vars) (string, error)
 	Exec(context.Context, *tasks.Request) (tasks.Result, error)
 	Routes() []*Route
 }
 
+// Checker is implemented by routers which check their routes for conflicts
+// as they are added. The routers produced by New implement it.
+type Checker interface {
+	Err() error
+}
+
+// Check produces an error describing every route of the provided router which
+// is ambiguous or unreachable, if the router implements Checker; otherwise it
+// produces nil.
+func Check(r Router) error {
+	if c, ok := r.(Checker); ok {
+		return c.Err()
+	}
+	return nil
+}
+
 type router struct {
 	routes []*Route
+	middle []Middleware
+	errs   []error
 }
 
 func New() Router {
@@ -144,21 +283,70 @@ func (r *router) Add(d string, t tasks.Task) *Route {
 		c = []path.Path{path.Parse(p)}
 	}
 
-	v := &Route{t, s, h, c}
+	v := &Route{router: r, task: t, scheme: s, host: h, paths: c}
+	r.check(v, v.patterns())
 	r.routes = append(r.routes, v)
 	return v
 }
 
-// Find a route for the request, if we have one
+// check records an error if any of the provided patterns, which belong to
+// the provided route, are ambiguous with or unreachable because of those of
+// another route
+func (r *router) check(v *Route, p [][]string) {
+	for _, e := range r.routes {
+		if e != v {
+			if err := conflict(v, p, e); err != nil {
+				r.errs = append(r.errs, err)
+			}
+		}
+	}
+}
+
+// Err produces an error describing every route which was found to be
+// ambiguous or unreachable when it was added, or nil if there are none.
+// Such routes are still matched according to their precedence.
+func (r *router) Err() error {
+	return errors.Join(r.errs...)
+}
+
+// Use adds middleware which wraps every task executed by the router,
+// regardless of which route handles it, including routes that were added
+// before the middleware
+func (r *router) Use(m ...Middleware) {
+	r.middle = append(r.middle, m...)
+}
+
+// Find the most specific route for the request, if we have one. A literal
+// host takes precedence over a variable host, which takes precedence over a
+// wildcard host. Among routes for equivalent hosts, paths are compared from
+// left to right and literal components take precedence over variables, which
+// take precedence over wildcards. When routes are equally specific the one
+// added first is used.
 func (r router) Find(utd *url.URL) (*Route, path.Vars, error) {
-	state := &matchState{}
+	var (
+		match *Route
+		vars  path.Vars
+		best  *matchState
+	)
+	for _, e := range r.routes {
+		state := &matchState{}
+		if m, v := e.Matches(utd, state); m && (best == nil || state.compare(best) < 0) {
+			match, vars, best = e, v, state
+		}
+	}
+	return match, vars, nil
+}
+
+// URL builds a UTD which is matched by the route with the provided name from
+// the provided variables. The UTD is escaped as necessary, so publishers can
+// use the same definition as the task which handles it.
+func (r router) URL(name string, vars path.Vars) (string, error) {
 	for _, e := range r.routes {
-		m, vars := e.Matches(utd, state)
-		if m {
-			return e, vars, nil
+		if e.name == name {
+			return e.URL(vars, nil)
 		}
 	}
-	return nil, nil, nil
+	return "", fmt.Errorf("%w: %s", ErrNoRoute, name)
 }
 
 // Exec a task for the provided UTD
@@ -176,7 +364,7 @@ func (r router) Exec(cxt context.Context, req *tasks.Request) (tasks.Result, err
 	if vars == nil {
 		vars = make(path.Vars)
 	}
-	return match.Exec(cxt, req, tasks.Params{
+	return chain(match, r.middle).Exec(cxt, req, tasks.Params{
 		Vars: vars,
 	})
 }
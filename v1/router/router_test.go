@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/utds"
 
 	"github.com/bww/go-router/v1/path"
 	"github.com/stretchr/testify/assert"
@@ -217,3 +218,182 @@ func TestWildcards(t *testing.T) {
 		}
 	}
 }
+
+func TestMiddleware(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next tasks.Task) tasks.Task {
+			return tasks.TaskFunc(func(cxt context.Context, req *tasks.Request, params tasks.Params) (tasks.Result, error) {
+				trace = append(trace, name)
+				return next.Exec(cxt, req, params)
+			})
+		}
+	}
+
+	rr := New()
+	rr.Use(mark("a"), mark("b"))
+	rr.Add("foo://bar/zip", tasks.TaskFunc(testRunTask)).Use(mark("c"))
+	rr.Add("foo://bar/zap", tasks.TaskFunc(testRunTask))
+	rr.Use(mark("d")) // applies to routes which were added before it
+
+	tests := []struct {
+		utd    string
+		expect []string
+	}{
+		{"foo://bar/zip", []string{"a", "b", "d", "c"}},
+		{"foo://bar/zap", []string{"a", "b", "d"}},
+	}
+	for _, e := range tests {
+		trace = nil
+		u, err := url.Parse(e.utd)
+		if assert.NoError(t, err) {
+			_, err := rr.Exec(context.Background(), tasks.NewRequest(u))
+			assert.Equal(t, errTestOk, err, e.utd)
+			assert.Equal(t, e.expect, trace, e.utd)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	rr := New()
+	r1 := rr.Add("sync://account/{id}/items", tasks.TaskFunc(testRunTask)).Name("items")
+	r2 := rr.Add("sync://{region}/account/{id}", tasks.TaskFunc(testRunTask)).Name("account")
+	_ = rr.Add("sync:/status", tasks.TaskFunc(testRunTask)).Name("status")
+	_ = rr.Add("sync://files/*", tasks.TaskFunc(testRunTask)).Name("files")
+
+	tests := []struct {
+		name   string
+		vars   path.Vars
+		expect string
+		route  *Route
+		err    error
+	}{
+		{
+			"items", path.Vars{"id": "123"},
+			"sync://account/123/items", r1, nil,
+		},
+		{
+			"items", path.Vars{"id": "a b?c"},
+			"sync://account/a%20b%3Fc/items", r1, nil,
+		},
+		{
+			"account", path.Vars{"region": "east", "id": "123"},
+			"sync://east/account/123", r2, nil,
+		},
+		{
+			"status", nil,
+			"sync:/status", nil, nil,
+		},
+		{
+			"items", path.Vars{},
+			"", nil, utds.ErrMissingVar,
+		},
+		{
+			"files", nil,
+			"", nil, utds.ErrWildcard,
+		},
+		{
+			"nothing", nil,
+			"", nil, ErrNoRoute,
+		},
+	}
+	for _, e := range tests {
+		utd, err := rr.URL(e.name, e.vars)
+		if e.err != nil {
+			assert.ErrorIs(t, err, e.err, e.name)
+			continue
+		}
+		if !assert.NoError(t, err, e.name) {
+			continue
+		}
+		assert.Equal(t, e.expect, utd, e.name)
+		if e.route != nil { // the UTD must be matched by the route it was built from, with the same vars
+			u, err := url.Parse(utd)
+			if assert.NoError(t, err, e.name) {
+				x, v, err := rr.Find(u)
+				if assert.NoError(t, err, e.name) {
+					assert.Equal(t, e.route, x, e.name)
+					assert.Equal(t, e.vars, v, e.name)
+				}
+			}
+		}
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	rr := New()
+	r1 := rr.Add("foo://*", tasks.TaskFunc(testRunTask))
+	r2 := rr.Add("foo://{host}/zop/**", tasks.TaskFunc(testRunTask))
+	r3 := rr.Add("foo://{host}/zip/{m}", tasks.TaskFunc(testRunTask))
+	r4 := rr.Add("foo://bar/*", tasks.TaskFunc(testRunTask))
+	r6 := rr.Add("foo://bar/zip/{m}/**", tasks.TaskFunc(testRunTask))
+	r7 := rr.Add("foo://bar/zip/{m}", tasks.TaskFunc(testRunTask))
+	r8 := rr.Add("foo://bar/zip/zap", tasks.TaskFunc(testRunTask))
+	if !assert.NoError(t, Check(rr)) {
+		return
+	}
+
+	tests := []struct {
+		utd   string
+		route *Route
+		vars  path.Vars
+	}{
+		{"foo://bar/zip/zap", r8, nil},
+		{"foo://bar/zip/zop", r7, path.Vars{"m": "zop"}},
+		{"foo://bar/zip/zop/zup", r6, path.Vars{"m": "zop"}},
+		{"foo://bar/zop", r4, nil},
+		{"foo://car/zip/zap", r3, path.Vars{"host": "car", "m": "zap"}},
+		{"foo://car/zop/zap", r2, path.Vars{"host": "car"}},
+		{"foo://car/zap", r1, nil},
+		{"bar://car/zop", nil, nil},
+	}
+
+	for _, e := range tests {
+		u, err := url.Parse(e.utd)
+		if assert.NoError(t, err, e.utd) {
+			x, v, err := rr.Find(u)
+			if assert.NoError(t, err, e.utd) {
+				assert.Equal(t, e.route, x, e.utd)
+				assert.Equal(t, e.vars, v, e.utd)
+			}
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		routes []string
+		err    error
+	}{
+		{[]string{"foo://bar/zip", "foo://bar/zap", "foo://bar/{m}", "foo://{h}/zip", "foo://*"}, nil},
+		{[]string{"foo://bar/zip/{m}", "foo://bar/{n}/zap"}, ErrAmbiguous},
+		{[]string{"foo://bar/*/zap", "foo://bar/zip/*"}, ErrAmbiguous},
+		{[]string{"foo://bar/zip/{m}", "foo://BAR/zip/{n}"}, ErrUnreachable},
+		{[]string{"foo://bar/zip", "foo://bar/zip"}, ErrUnreachable},
+		{[]string{"foo://bar/*", "foo://bar/**"}, ErrUnreachable},
+		{[]string{"foo://*", "foo:*"}, ErrUnreachable},
+		{[]string{"foo://{h}/*", "foo://{g}/**"}, ErrUnreachable},
+		{[]string{"foo://*", "foo://{h}/*"}, ErrUnreachable},
+		{[]string{"foo://{h}/**", "foo://*"}, ErrUnreachable},
+		{[]string{"foo://bar/zip/{m}", "foo://bar/zip/*"}, ErrUnreachable},
+		{[]string{"foo://bar/zip/*", "foo://bar/zip/{m}"}, ErrUnreachable},
+		{[]string{"foo://bar/zip/{m}", "zap://bar/zip/{n}"}, nil},
+	}
+	for _, e := range tests {
+		rr := New()
+		for _, r := range e.routes {
+			rr.Add(r, tasks.TaskFunc(testRunTask))
+		}
+		if e.err != nil {
+			assert.ErrorIs(t, Check(rr), e.err, e.routes)
+		} else {
+			assert.NoError(t, Check(rr), e.routes)
+		}
+	}
+
+	// paths added to a route are checked, too
+	rr := New()
+	rr.Add("foo://bar/zip", tasks.TaskFunc(testRunTask))
+	rr.Add("foo://bar/zap", tasks.TaskFunc(testRunTask)).Paths("/zip")
+	assert.ErrorIs(t, Check(rr), ErrUnreachable)
+}
@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+)
+
+type Config struct {
+	Queue    *tasks.Queue
+	Jobs     []Job
+	Location *time.Location // the location in which schedules are evaluated; defaults to UTC
+	Logger   *slog.Logger
+	Verbose  bool
+}
+
+func (c Config) WithOptions(opts []Option) Config {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type Option func(Config) Config
+
+func WithJobs(v ...Job) Option {
+	return func(c Config) Config {
+		c.Jobs = append(c.Jobs, v...)
+		return c
+	}
+}
+
+func WithLocation(v *time.Location) Option {
+	return func(c Config) Config {
+		c.Location = v
+		return c
+	}
+}
+
+func WithLogger(v *slog.Logger) Option {
+	return func(c Config) Config {
+		c.Logger = v
+		return c
+	}
+}
+
+func WithVerbose(v bool) Option {
+	return func(c Config) Config {
+		c.Verbose = v
+		return c
+	}
+}
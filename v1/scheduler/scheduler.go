@@ -0,0 +1,240 @@
+// Package scheduler publishes tasks on a cron schedule. Every node in a
+// cluster may run a scheduler with the same jobs; each tick of a job is
+// claimed through the worklog, so only one node publishes it.
+//
+// A tick is claimed by creating the worklog entry for a task whose
+// identifier is derived from the job name and the time of the tick. Every
+// node derives the same identifier for the same tick, so only the first node
+// to create the entry succeeds; the others observe a conflict and skip it.
+// The claimed task is then published as a Cronjob message.
+//
+// The claim expires shortly after it is made and is renewed without an
+// expiry once the task has been published. Should the node which claimed a
+// tick stop before it publishes the task, the claim expires and the task is
+// published by the promoter instead; see
+// [github.com/bww/go-tasks/v1/promoter].
+package scheduler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/tracing"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-alert/v1"
+	"github.com/bww/go-ident/v1"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrStopped       = errors.New("Not running")
+	ErrInvalidConfig = errors.New("Invalid configuration")
+	ErrInvalidJob    = errors.New("Invalid job")
+	ErrNoSuchJob     = errors.New("No such job")
+)
+
+// AttrSchedule is the attribute which records the tick a task was
+// published for
+const AttrSchedule = "schedule"
+
+// how long a claim on a tick is held before the task is published; if it
+// expires first, the promoter publishes the task
+const claimTTL = time.Minute
+
+// Job describes a task which is published on a schedule. The schedule is a
+// standard cron expression, e.g., "*/5 * * * *", or a descriptor such as
+// "@hourly" or "@every 30s".
+type Job struct {
+	Name     string           `json:"name"` // uniquely identifies the job; defaults to the UTD
+	Schedule string           `json:"schedule"`
+	UTD      string           `json:"utd"`
+	Data     []byte           `json:"data,omitempty"`
+	Attrs    attrs.Attributes `json:"attrs,omitempty"`
+}
+
+type job struct {
+	Job
+	sched cron.Schedule
+	next  time.Time
+}
+
+type Scheduler struct {
+	queue   *tasks.Queue
+	worklog worklog.Worklog
+	jobs    map[string]*job
+	loc     *time.Location
+	log     *slog.Logger
+	verbose bool
+}
+
+func New(q *tasks.Queue, opts ...Option) (*Scheduler, error) {
+	return NewWithConfig(Config{
+		Queue: q,
+	}.WithOptions(opts))
+}
+
+func NewWithConfig(conf Config) (*Scheduler, error) {
+	if conf.Queue == nil {
+		return nil, fmt.Errorf("%w: No queue provided", ErrInvalidConfig)
+	}
+	if conf.Queue.Worklog() == nil {
+		return nil, fmt.Errorf("%w: Queue has no worklog", ErrInvalidConfig)
+	}
+	if conf.Logger == nil {
+		conf.Logger = slog.Default()
+	}
+	loc := conf.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	jobs := make(map[string]*job)
+	for _, e := range conf.Jobs {
+		if e.Name == "" {
+			e.Name = e.UTD
+		}
+		if e.UTD == "" {
+			return nil, fmt.Errorf("%w: No UTD: %s", ErrInvalidJob, e.Name)
+		}
+		if _, ok := jobs[e.Name]; ok {
+			return nil, fmt.Errorf("%w: Duplicate name: %s", ErrInvalidJob, e.Name)
+		}
+		sched, err := cron.ParseStandard(e.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidJob, e.Name, err)
+		}
+		jobs[e.Name] = &job{Job: e, sched: sched}
+	}
+
+	return &Scheduler{
+		queue:   conf.Queue,
+		worklog: tracing.Worklog(conf.Queue.Worklog()),
+		jobs:    jobs,
+		loc:     loc,
+		log:     conf.Logger.With("system", "scheduler"),
+		verbose: conf.Verbose,
+	}, nil
+}
+
+// Run publishes jobs as they come due until the context is canceled. If a
+// tick is missed, e.g., because the node was suspended, only the latest tick
+// which is due is published.
+func (s *Scheduler) Run(cxt context.Context) error {
+	if len(s.jobs) == 0 {
+		<-cxt.Done()
+		return ErrStopped
+	}
+
+	now := time.Now().In(s.loc)
+	for _, e := range s.jobs {
+		e.next = e.sched.Next(now)
+	}
+
+	for {
+		var wake time.Time
+		for _, e := range s.jobs {
+			if wake.IsZero() || e.next.Before(wake) {
+				wake = e.next
+			}
+		}
+
+		select {
+		case <-cxt.Done():
+			return ErrStopped
+		case <-time.After(time.Until(wake)):
+			// check for jobs which are due
+		}
+
+		now := time.Now().In(s.loc)
+		for _, e := range s.jobs {
+			if e.next.After(now) {
+				continue
+			}
+			tick := e.next
+			e.next = e.sched.Next(now)
+			_, err := s.fire(cxt, e, tick)
+			if err != nil {
+				alert.Error(fmt.Errorf("Could not publish scheduled job: %s: %w", e.Name, err), alert.WithTags(alert.Tags{"job": e.Name, "utd": e.UTD}))
+			}
+		}
+	}
+}
+
+// Fire publishes the named job for the provided tick, unless that tick has
+// already been published by this or any other node, and reports whether
+// it was published. This is invoked by Run as jobs come due; it is not
+// normally necessary to call it directly.
+func (s *Scheduler) Fire(cxt context.Context, name string, tick time.Time) (bool, error) {
+	e, ok := s.jobs[name]
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrNoSuchJob, name)
+	}
+	return s.fire(cxt, e, tick)
+}
+
+func (s *Scheduler) fire(cxt context.Context, e *job, tick time.Time) (bool, error) {
+	log := s.log.With("job", e.Name, "utd", e.UTD, "tick", tick)
+
+	id, err := tickId(e.Name, tick)
+	if err != nil {
+		return false, err
+	}
+
+	a := make(attrs.Attributes)
+	for k, v := range e.Attrs {
+		a[k] = v
+	}
+	a[AttrSchedule] = tick.Format(time.RFC3339)
+
+	msg := transport.NewWithId(id, e.UTD).SetData(e.Data).SetAttrs(a)
+	msg.Type = transport.Cronjob
+
+	// claim the tick; if the entry already exists, someone else has
+	now := time.Now()
+	claim := msg.Entry(worklog.Pending, now).SetExpires(now.Add(claimTTL))
+	err = s.worklog.CreateEntry(cxt, claim)
+	if errors.Is(err, worklog.ErrConflict) {
+		if s.verbose {
+			log.Info("Scheduled job was already published")
+		}
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Could not claim tick: %w", err)
+	}
+
+	err = s.queue.Publish(cxt, msg)
+	if err != nil {
+		return false, err
+	}
+
+	// the task has been published, so the claim no longer needs to expire; if
+	// this fails, the task may be published again by the promoter, but it
+	// still only runs once
+	err = s.worklog.StoreEntry(cxt, claim.Next(worklog.Pending, claim.Data))
+	if err != nil && !errors.Is(err, worklog.ErrConflict) { // the task may already be running
+		alert.Error(fmt.Errorf("Could not record published scheduled job: %w", err), alert.WithTags(alert.Tags{"job": e.Name, "utd": e.UTD}))
+	}
+
+	log.Info("Published scheduled job", "task_id", id.String())
+	return true, nil
+}
+
+// tickId derives the task identifier for a tick of a job. It resembles any
+// other identifier: its timestamp is that of the tick and the remainder is
+// derived from the job name.
+func tickId(name string, tick time.Time) (ident.Ident, error) {
+	sum := sha256.Sum256([]byte(name))
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b, uint32(tick.Unix()))
+	copy(b[4:], sum[:8])
+	return ident.FromBytes(b)
+}
@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1"
+	"github.com/bww/go-tasks/v1/internal/queuetest"
+	"github.com/bww/go-tasks/v1/promoter"
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFire(t *testing.T) {
+	cxt := context.Background()
+	wl := memory.New()
+	tq := queuetest.New()
+	job := Job{Name: "report", Schedule: "*/5 * * * *", UTD: "test://report", Data: []byte("data")}
+
+	// two nodes are configured with the same job
+	var nodes []*Scheduler
+	for i := 0; i < 2; i++ {
+		s, err := New(tasks.NewQueue(tq, wl), WithJobs(job))
+		if !assert.NoError(t, err) {
+			return
+		}
+		nodes = append(nodes, s)
+	}
+
+	tick := time.Date(2024, 1, 1, 12, 5, 0, 0, time.UTC)
+	var fired int
+	for _, s := range nodes {
+		ok, err := s.Fire(cxt, "report", tick)
+		if assert.NoError(t, err) && ok {
+			fired++
+		}
+	}
+	assert.Equal(t, 1, fired)
+
+	// a subsequent tick is independent
+	ok, err := nodes[1].Fire(cxt, "report", tick.Add(time.Minute*5))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	if assert.Len(t, tq.Published(), 2) {
+		msg, err := transport.Parse(tq.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, transport.Cronjob, msg.Type)
+			assert.Equal(t, "test://report", msg.UTD)
+			assert.Equal(t, []byte("data"), msg.Data)
+			assert.Equal(t, "2024-01-01T12:05:00Z", msg.Attrs[AttrSchedule])
+			ent, err := wl.FetchLatestEntryForTask(cxt, msg.Id)
+			if assert.NoError(t, err) {
+				assert.Equal(t, worklog.Pending, ent.State)
+				assert.Nil(t, ent.Expires) // the task was published
+			}
+		}
+	}
+
+	_, err = nodes[0].Fire(cxt, "unknown", tick)
+	assert.ErrorIs(t, err, ErrNoSuchJob)
+}
+
+func TestFireRecover(t *testing.T) {
+	cxt := context.Background()
+	wl := memory.New()
+	unavailable := errors.New("Unavailable")
+	tq := queuetest.New().SetError(unavailable)
+	job := Job{Name: "report", Schedule: "@hourly", UTD: "test://report"}
+
+	s, err := New(tasks.NewQueue(tq, wl), WithJobs(job))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the tick is claimed but the task cannot be published
+	tick := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, err = s.Fire(cxt, "report", tick)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Len(t, tq.Published(), 0)
+
+	// the claim expires, at which point the promoter publishes the task
+	tq.SetError(nil)
+	p, err := promoter.New(tasks.NewQueue(tq, wl))
+	if !assert.NoError(t, err) {
+		return
+	}
+	n, err := p.Promote(cxt, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = p.Promote(cxt, time.Now().Add(claimTTL*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	if assert.Len(t, tq.Published(), 1) {
+		msg, err := transport.Parse(tq.Published()[0])
+		if assert.NoError(t, err) {
+			assert.Equal(t, "test://report", msg.UTD)
+			assert.Equal(t, "2024-01-01T12:00:00Z", msg.Attrs[AttrSchedule])
+		}
+	}
+
+	// the tick has been claimed, so it is not published again
+	ok, err := s.Fire(cxt, "report", tick)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestConfig(t *testing.T) {
+	q := tasks.NewQueue(queuetest.New(), memory.New())
+	_, err := New(q, WithJobs(Job{Schedule: "not a schedule", UTD: "test://a"}))
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	_, err = New(q, WithJobs(Job{Schedule: "@hourly"}))
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	_, err = New(q, WithJobs(Job{Schedule: "@hourly", UTD: "test://a"}, Job{Schedule: "@daily", UTD: "test://a"}))
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	_, err = New(tasks.NewQueue(queuetest.New(), nil))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"time"
@@ -16,10 +17,22 @@ import (
 	"github.com/bww/go-router/v2"
 	"github.com/bww/go-tasks/v1"
 	"github.com/bww/go-tasks/v1/exec"
+	"github.com/bww/go-tasks/v1/tracing"
 	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
 	"github.com/bww/go-util/v1/urls"
 	"github.com/bww/go-validate/v1"
 	"github.com/dustin/go-humanize"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
 )
 
 const (
@@ -28,6 +41,7 @@ const (
 
 	ExecResource  = "exec"
 	QueueResource = "queue"
+	TaskResource  = "task"
 )
 
 func scope(r string, a ...acl.Action) acl.Scopes {
@@ -67,8 +81,18 @@ func NewWithConfig(conf Config) (*Service, error) {
 	r.Add(urls.Join(conf.Prefix, "/status"), s.handleStatus).Methods("GET")
 	// Submit a task to the queue so it can be scheduled for normal execution; this is the way work is normally submitted to the service
 	r.Add(urls.Join(conf.Prefix, "/v1/queue"), s.handleWriteQueue).Methods("POST").Use(middle.ACL(jwtacl, dataRealm, scope(QueueResource, acl.Write)))
+	// Submit a workflow of dependent tasks to the queue; its initial steps are scheduled immediately and the remainder as their parents complete
+	r.Add(urls.Join(conf.Prefix, "/v1/workflows"), s.handleWriteWorkflow).Methods("POST").Use(middle.ACL(jwtacl, dataRealm, scope(QueueResource, acl.Write)))
 	// Submit a task DIRECTLY to the local executor and wait for it to finish SYNCHRONOUSLY; this is really only intended for testing scenarios
 	r.Add(urls.Join(conf.Prefix, "/v1/tasks"), s.handleExecTask).Methods("POST").Use(middle.ACL(jwtacl, dataRealm, scope(ExecResource, acl.Write)))
+	// List the latest entry for every managed task which matches the provided criteria
+	r.Add(urls.Join(conf.Prefix, "/v1/tasks"), s.handleListTasks).Methods("GET").Use(middle.ACL(jwtacl, dataRealm, scope(TaskResource, acl.Read)))
+	// Obtain the current status of a managed task
+	r.Add(urls.Join(conf.Prefix, "/v1/tasks/{id}"), s.handleFetchTask).Methods("GET").Use(middle.ACL(jwtacl, dataRealm, scope(TaskResource, acl.Read)))
+	// Obtain every entry in the worklog for a managed task, in sequence order
+	r.Add(urls.Join(conf.Prefix, "/v1/tasks/{id}/history"), s.handleFetchTaskHistory).Methods("GET").Use(middle.ACL(jwtacl, dataRealm, scope(TaskResource, acl.Read)))
+	// Cancel a managed task wherever it is executing in the cluster
+	r.Add(urls.Join(conf.Prefix, "/v1/tasks/{id}"), s.handleCancelTask).Methods("DELETE").Use(middle.ACL(jwtacl, dataRealm, scope(TaskResource, acl.Delete)))
 
 	return s, nil
 }
@@ -105,7 +129,7 @@ func (s *Service) handleWriteQueue(req *router.Request, cxt router.Context) (*ro
 
 	conf, err := tasks.PublishConfigFromParams(req.URL.Query())
 	if err != nil {
-		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid parameters").SetCause(err)
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid parameters").SetCode(tasks.CodeInvalidParameters).SetCause(err)
 	}
 
 	var msg *transport.Message
@@ -119,7 +143,7 @@ func (s *Service) handleWriteQueue(req *router.Request, cxt router.Context) (*ro
 	}
 
 	s.log.With("utd", msg.UTD, "size", humanize.Bytes(uint64(len(msg.Data)))).Info("Publish task")
-	err = s.queue.Publish(req.Context(), msg, tasks.UseConfig(conf))
+	err = s.queue.Publish(traceContext(req, msg), msg, tasks.UseConfig(conf))
 	if err != nil {
 		return nil, resterrs.Errorf(http.StatusBadGateway, "Could not publish task").SetCause(err)
 	}
@@ -127,6 +151,37 @@ func (s *Service) handleWriteQueue(req *router.Request, cxt router.Context) (*ro
 	return response.JSON(msg), nil
 }
 
+func (s *Service) handleWriteWorkflow(req *router.Request, cxt router.Context) (*router.Response, error) {
+	if s.queue == nil {
+		return nil, resterrs.Errorf(http.StatusServiceUnavailable, "Task queue is not available")
+	}
+
+	conf, err := tasks.PublishConfigFromParams(req.URL.Query())
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid parameters").SetCode(tasks.CodeInvalidParameters).SetCause(err)
+	}
+
+	var wf *worklog.Workflow
+	err = httputil.Unmarshal(req, &wf)
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Could not unmarshal entity").SetCause(err)
+	}
+	err = wf.Validate()
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid workflow: %v", err).SetCode(tasks.CodeInvalidRequest).SetCause(err)
+	}
+
+	s.log.With("steps", len(wf.Steps)).Info("Publish workflow")
+	err = s.queue.PublishWorkflow(traceContext(req, nil), wf, tasks.UseConfig(conf))
+	if errors.Is(err, tasks.ErrNoWorklog) {
+		return nil, resterrs.Errorf(http.StatusServiceUnavailable, "Task worklog is not available").SetCause(err)
+	} else if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadGateway, "Could not publish workflow").SetCause(err)
+	}
+
+	return response.JSON(wf), nil
+}
+
 func (s *Service) handleExecTask(req *router.Request, cxt router.Context) (*router.Response, error) {
 	if s.exec == nil {
 		return nil, resterrs.Errorf(http.StatusServiceUnavailable, "Task executor is not available")
@@ -143,10 +198,151 @@ func (s *Service) handleExecTask(req *router.Request, cxt router.Context) (*rout
 	}
 
 	s.log.With("utd", msg.UTD, "size", humanize.Bytes(uint64(len(msg.Data)))).Info("Execute task (synchronous)")
-	res, err := s.exec.Proc(req.Context(), msg, nil)
+	res, err := s.exec.Proc(traceContext(req, msg), msg, nil)
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadGateway, "%s", err.Error()).SetCode(resterrs.Code(tasks.ErrorCode(err))).SetCause(err)
+	}
+
+	return response.JSON(res), nil
+}
+
+type entryList struct {
+	Entries []*worklog.Entry `json:"entries"`
+}
+
+func (s *Service) worklog() (worklog.Worklog, error) {
+	if s.queue == nil || s.queue.Worklog() == nil {
+		return nil, resterrs.Errorf(http.StatusServiceUnavailable, "Task worklog is not available")
+	}
+	return tracing.Worklog(s.queue.Worklog()), nil
+}
+
+func (s *Service) handleListTasks(req *router.Request, cxt router.Context) (*router.Response, error) {
+	wl, err := s.worklog()
+	if err != nil {
+		return nil, err
+	}
+
+	params := req.URL.Query()
+	crit, err := worklog.CriteriaFromParams(params)
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid parameters").SetCode(tasks.CodeInvalidParameters).SetCause(err)
+	}
+	if v := params.Get("limit"); v == "" {
+		crit.Limit = defaultListLimit
+	} else if crit.Limit < 1 {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid limit: %s", v)
+	} else {
+		crit.Limit = min(crit.Limit, maxListLimit)
+	}
+
+	it, err := wl.IterLatestEntryForEveryTask(req.Context(), crit, time.Now())
 	if err != nil {
-		return nil, resterrs.Errorf(http.StatusBadGateway, "%s", err.Error()).SetCause(err)
+		return nil, resterrs.Errorf(http.StatusBadGateway, "Could not list tasks").SetCause(err)
+	}
+	defer it.Close()
+
+	res := entryList{Entries: make([]*worklog.Entry, 0)}
+	for {
+		ent, err := it.Next()
+		if siter.IsFinished(err) {
+			break
+		} else if err != nil {
+			return nil, resterrs.Errorf(http.StatusBadGateway, "Could not list tasks").SetCause(err)
+		}
+		res.Entries = append(res.Entries, ent)
 	}
 
 	return response.JSON(res), nil
 }
+
+func (s *Service) handleFetchTask(req *router.Request, cxt router.Context) (*router.Response, error) {
+	wl, err := s.worklog()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := ident.Parse(cxt.Vars["id"])
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid task identifier").SetCause(err)
+	}
+
+	ent, err := wl.FetchLatestEntryForTask(req.Context(), id)
+	if errors.Is(err, worklog.ErrNotFound) {
+		return nil, resterrs.Errorf(http.StatusNotFound, "No such task").SetCause(err)
+	} else if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadGateway, "Could not fetch task").SetCause(err)
+	}
+
+	return response.JSON(ent), nil
+}
+
+func (s *Service) handleFetchTaskHistory(req *router.Request, cxt router.Context) (*router.Response, error) {
+	wl, err := s.worklog()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := ident.Parse(cxt.Vars["id"])
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid task identifier").SetCause(err)
+	}
+
+	res, err := worklog.FetchHistory(req.Context(), wl, id)
+	if errors.Is(err, worklog.ErrNotFound) {
+		return nil, resterrs.Errorf(http.StatusNotFound, "No such task").SetCause(err)
+	} else if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadGateway, "Could not fetch task history").SetCause(err)
+	}
+
+	return response.JSON(entryList{Entries: res}), nil
+}
+
+func (s *Service) handleCancelTask(req *router.Request, cxt router.Context) (*router.Response, error) {
+	_, err := s.worklog()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := ident.Parse(cxt.Vars["id"])
+	if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadRequest, "Invalid task identifier").SetCause(err)
+	}
+
+	s.log.With("task_id", id.String()).Info("Cancel task")
+	ent, err := s.queue.Cancel(req.Context(), id)
+	if errors.Is(err, worklog.ErrNotFound) {
+		return nil, resterrs.Errorf(http.StatusNotFound, "No such task").SetCause(err)
+	} else if errors.Is(err, worklog.ErrResolved) {
+		return nil, resterrs.Errorf(http.StatusConflict, "Task is already resolved: %v", ent.State).SetCause(err)
+	} else if errors.Is(err, worklog.ErrConflict) {
+		return nil, resterrs.Errorf(http.StatusConflict, "Task is being updated; try again").SetCause(err)
+	} else if err != nil {
+		return nil, resterrs.Errorf(http.StatusBadGateway, "Could not cancel task").SetCause(err)
+	}
+
+	// if the task happens to be running on this node, we can stop it now
+	// instead of waiting for it to observe the cancellation
+	if s.exec != nil {
+		s.exec.Cancel(id)
+	}
+
+	return response.JSON(ent), nil
+}
+
+// traceContext produces a context for a request which continues the trace of
+// the caller. The trace is taken from the W3C Trace Context headers of the
+// request or, failing that, from the message the caller submitted, if any.
+// If the context already has a trace, e.g., because the server itself is
+// instrumented, it is used as-is.
+func traceContext(req *router.Request, msg *transport.Message) context.Context {
+	cxt := req.Context()
+	if trace.SpanContextFromContext(cxt).IsValid() {
+		return cxt
+	}
+	cxt = tracing.Extract(cxt, propagation.HeaderCarrier(req.Header))
+	if msg != nil && !trace.SpanContextFromContext(cxt).IsValid() {
+		cxt = msg.TraceContext(cxt)
+	}
+	return cxt
+}
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"net/url"
 
+	"github.com/bww/go-tasks/v1/attrs"
+
 	"github.com/dustin/go-humanize"
 )
 
@@ -17,6 +19,7 @@ type Request struct {
 	Run    string // the execution run identifier
 	UTD    *url.URL
 	Entity []byte
+	Attrs  attrs.Attributes
 }
 
 func NewRequest(utd *url.URL) *Request {
@@ -35,6 +38,12 @@ func (r *Request) WithEntity(data []byte) *Request {
 	return &d
 }
 
+func (r *Request) WithAttrs(a attrs.Attributes) *Request {
+	d := *r
+	d.Attrs = a
+	return &d
+}
+
 func (r *Request) Logger(base *slog.Logger) *slog.Logger {
 	return base.With("run", r.Run, "utd", r.UTD.String(), "size", humanize.Bytes(uint64(len(r.Entity))))
 }
@@ -0,0 +1,88 @@
+// Package tracing provides the OpenTelemetry instrumentation shared by the
+// publisher and the executor. Spans are created with the global tracer
+// provider, so tracing is enabled by installing one with
+// [go.opentelemetry.io/otel.SetTracerProvider]; until then, it costs nothing.
+//
+// The trace context of a publication is recorded on the message it publishes
+// in the W3C Trace Context format, and the execution of that message
+// continues the trace, so a task can be followed from the request that
+// published it, through its execution, to the tasks it triggers.
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the name of the instrumentation library
+const Name = "github.com/bww/go-tasks/v1"
+
+// Span attributes
+const (
+	AttrUTD     = attribute.Key("tasks.utd")
+	AttrTaskId  = attribute.Key("tasks.task_id")
+	AttrTaskSeq = attribute.Key("tasks.task_seq")
+	AttrType    = attribute.Key("tasks.type")
+	AttrState   = attribute.Key("tasks.state")
+	AttrRoute   = attribute.Key("tasks.route")
+)
+
+// trace context is always propagated as W3C Trace Context, regardless of the
+// global propagator, since that is what is recorded on messages
+var propagator = propagation.TraceContext{}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// Start starts a span with the global tracer provider
+func Start(cxt context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(cxt, name, opts...)
+}
+
+// End ends a span, recording the error it ended with, if any
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject records the trace context of cxt in the carrier
+func Inject(cxt context.Context, c propagation.TextMapCarrier) {
+	propagator.Inject(cxt, c)
+}
+
+// Extract produces a context which continues the trace recorded in the
+// carrier, if there is one
+func Extract(cxt context.Context, c propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(cxt, c)
+}
+
+// EntryAttributes produces span attributes which describe a worklog entry
+func EntryAttributes(ent *worklog.Entry) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AttrTaskId.String(ent.TaskId.String()),
+		AttrTaskSeq.Int64(ent.TaskSeq),
+		AttrState.String(string(ent.State)),
+		AttrUTD.String(ent.UTD),
+	}
+}
+
+// endWorklog ends a span for a worklog operation; a missing entry is an
+// expected outcome rather than an error
+func endWorklog(span trace.Span, err error) {
+	if errors.Is(err, worklog.ErrNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
@@ -0,0 +1,37 @@
+// Package tracingtest records the spans produced during a test in memory.
+package tracingtest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Install installs a tracer provider which exports spans to memory as the
+// global provider until the test completes, and produces its exporter. Spans
+// are exported synchronously, as soon as they end.
+func Install(t testing.TB) *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		tp.Shutdown(context.Background())
+	})
+	return exp
+}
+
+// Find produces the spans with the provided name
+func Find(exp *tracetest.InMemoryExporter, name string) tracetest.SpanStubs {
+	var res tracetest.SpanStubs
+	for _, e := range exp.GetSpans() {
+		if e.Name == name {
+			res = append(res, e)
+		}
+	}
+	return res
+}
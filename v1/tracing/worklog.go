@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracedWorklog struct {
+	worklog.Worklog
+}
+
+// Worklog wraps a worklog so that every operation on it is traced. Wrapping
+// a worklog which is already traced has no effect. The wrapped worklog
+// always implements worklog.HistoryWorklog.
+func Worklog(wl worklog.Worklog) worklog.Worklog {
+	if wl == nil {
+		return nil
+	} else if _, ok := wl.(*tracedWorklog); ok {
+		return wl
+	} else {
+		return &tracedWorklog{wl}
+	}
+}
+
+// Unwrap produces the worklog a traced worklog wraps. A worklog which is not
+// traced is produced as-is.
+func Unwrap(wl worklog.Worklog) worklog.Worklog {
+	if t, ok := wl.(*tracedWorklog); ok {
+		return t.Unwrap()
+	} else {
+		return wl
+	}
+}
+
+// Unwrap produces the worklog this one wraps
+func (w *tracedWorklog) Unwrap() worklog.Worklog {
+	return w.Worklog
+}
+
+func (w *tracedWorklog) CreateEntry(cxt context.Context, ent *worklog.Entry) error {
+	cxt, span := Start(cxt, "worklog.CreateEntry", trace.WithAttributes(EntryAttributes(ent)...))
+	err := w.Worklog.CreateEntry(cxt, ent)
+	endWorklog(span, err)
+	return err
+}
+
+func (w *tracedWorklog) StoreEntry(cxt context.Context, ent *worklog.Entry) error {
+	cxt, span := Start(cxt, "worklog.StoreEntry", trace.WithAttributes(EntryAttributes(ent)...))
+	err := w.Worklog.StoreEntry(cxt, ent)
+	endWorklog(span, err)
+	return err
+}
+
+func (w *tracedWorklog) RenewEntry(cxt context.Context, ent *worklog.Entry, expires time.Time) (*worklog.Entry, error) {
+	cxt, span := Start(cxt, "worklog.RenewEntry", trace.WithAttributes(EntryAttributes(ent)...))
+	res, err := w.Worklog.RenewEntry(cxt, ent, expires)
+	endWorklog(span, err)
+	return res, err
+}
+
+func (w *tracedWorklog) FetchEntry(cxt context.Context, id ident.Ident, seq int64) (*worklog.Entry, error) {
+	cxt, span := Start(cxt, "worklog.FetchEntry", trace.WithAttributes(AttrTaskId.String(id.String()), AttrTaskSeq.Int64(seq)))
+	res, err := w.Worklog.FetchEntry(cxt, id, seq)
+	endWorklog(span, err)
+	return res, err
+}
+
+func (w *tracedWorklog) FetchLatestEntryForTask(cxt context.Context, id ident.Ident) (*worklog.Entry, error) {
+	cxt, span := Start(cxt, "worklog.FetchLatestEntryForTask", trace.WithAttributes(AttrTaskId.String(id.String())))
+	res, err := w.Worklog.FetchLatestEntryForTask(cxt, id)
+	if err == nil {
+		span.SetAttributes(AttrState.String(string(res.State)))
+	}
+	endWorklog(span, err)
+	return res, err
+}
+
+func (w *tracedWorklog) FetchEveryEntryForTask(cxt context.Context, id ident.Ident) ([]*worklog.Entry, error) {
+	cxt, span := Start(cxt, "worklog.FetchEveryEntryForTask", trace.WithAttributes(AttrTaskId.String(id.String())))
+	res, err := worklog.FetchHistory(cxt, w.Worklog, id)
+	endWorklog(span, err)
+	return res, err
+}
+
+func (w *tracedWorklog) IterLatestEntryForEveryTask(cxt context.Context, crit worklog.Criteria, when time.Time) (siter.Iterator[*worklog.Entry], error) {
+	cxt, span := Start(cxt, "worklog.IterLatestEntryForEveryTask")
+	res, err := w.Worklog.IterLatestEntryForEveryTask(cxt, crit, when)
+	endWorklog(span, err)
+	return res, err
+}
+
+func (w *tracedWorklog) DeleteEveryEntryForTask(cxt context.Context, id ident.Ident) error {
+	cxt, span := Start(cxt, "worklog.DeleteEveryEntryForTask", trace.WithAttributes(AttrTaskId.String(id.String())))
+	err := w.Worklog.DeleteEveryEntryForTask(cxt, id)
+	endWorklog(span, err)
+	return err
+}
@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+)
+
+// Forward describes how the result of a task is handed to the tasks it
+// triggers.
+type Forward string
+
+const (
+	ForwardNone  = Forward("")      // the result is not forwarded
+	ForwardData  = Forward("data")  // the result becomes the entity of the triggered task
+	ForwardAttrs = Forward("attrs") // the result is merged into the attributes of the triggered task
+)
+
+// SetForward sets how the result of this task is forwarded to the tasks it
+// triggers. The setting is inherited by triggered tasks, so it applies to an
+// entire chain.
+func (m *Message) SetForward(f Forward) *Message {
+	if f == ForwardNone {
+		delete(m.Attrs, worklog.AttrForward)
+		return m
+	}
+	return m.SetAttr(worklog.AttrForward, string(f))
+}
+
+func (m *Message) Forward() Forward {
+	return Forward(m.Attrs[worklog.AttrForward])
+}
+
+// Dependent produces the message for a task with the provided UTD that is
+// triggered when this message's task resolves. The parent entry describes
+// how it resolved; its data is the result of the task.
+//
+// The dependent task is annotated with the provenance of its parent and, if
+// this message forwards its result, receives it as configured.
+func (m *Message) Dependent(utd string, triggers worklog.Triggers, parent *worklog.Entry) *Message {
+	d := New(utd).SetTriggers(triggers)
+	if m.Type == Oneshot {
+		d.Type = Oneshot // dependents of a oneshot task are also oneshot
+	}
+	d.Attrs = attrs.Attributes{
+		worklog.AttrParentSeq:   strconv.FormatInt(parent.TaskSeq, 10),
+		worklog.AttrParentState: string(parent.State),
+	}
+	if m.Id != ident.Zero {
+		d.Attrs[worklog.AttrParentId] = m.Id.String()
+	}
+	switch f := m.Forward(); f {
+	case ForwardData:
+		d.SetData(parent.Data).SetForward(f)
+	case ForwardAttrs:
+		mergeResult(d.Attrs, parent.Data)
+		d.SetForward(f)
+	}
+	return d
+}
+
+// mergeResult merges a result into attributes. If the result is a JSON
+// object each of its fields becomes an attribute; strings are used as-is and
+// other values as their JSON representation. Any other result is stored
+// whole under AttrResult. Provenance attributes are never overwritten.
+func mergeResult(a attrs.Attributes, res []byte) {
+	if len(res) == 0 {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(res, &fields) != nil {
+		a[worklog.AttrResult] = string(res)
+		return
+	}
+	for k, v := range fields {
+		if _, ok := a[k]; ok {
+			continue
+		}
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			a[k] = s
+		} else {
+			a[k] = string(v)
+		}
+	}
+}
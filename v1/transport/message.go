@@ -29,13 +29,15 @@ const (
 )
 
 type Message struct {
-	Id       ident.Ident      `json:"id"`
-	Seq      int64            `json:"seq"` // generally speaking, don't mess with the sequence
-	Type     Type             `json:"type"`
-	UTD      string           `json:"utd" check:"len(self) > 0" invalid:"Task UTD is required"`
-	Data     []byte           `json:"data,omitempty"`
-	Attrs    attrs.Attributes `json:"attrs,omitempty"`
-	Triggers worklog.Triggers `json:"triggers,omitempty"`
+	Id        ident.Ident       `json:"id"`
+	Seq       int64             `json:"seq"` // generally speaking, don't mess with the sequence
+	Type      Type              `json:"type"`
+	UTD       string            `json:"utd" check:"len(self) > 0" invalid:"Task UTD is required"`
+	Data      []byte            `json:"data,omitempty"`
+	Attrs     attrs.Attributes  `json:"attrs,omitempty"`
+	Triggers  worklog.Triggers  `json:"triggers,omitempty"`
+	Workflow  *worklog.Workflow `json:"workflow,omitempty"`
+	NotBefore *time.Time        `json:"not_before,omitempty"`
 }
 
 func New(utd string) *Message {
@@ -53,6 +55,36 @@ func NewWithId(id ident.Ident, utd string) *Message {
 	}
 }
 
+// NewStep creates a message which performs the named step of a workflow. The
+// step's task identifier must have been assigned.
+func NewStep(wf *worklog.Workflow, name string) *Message {
+	step := wf.Steps[name]
+	return &Message{
+		Id:       step.TaskId,
+		Type:     Managed,
+		UTD:      step.UTD,
+		Data:     step.Data,
+		Attrs:    step.Attrs,
+		Workflow: wf.ForStep(name),
+	}
+}
+
+// NewWithEntry creates a managed message which resumes the task described by
+// a worklog entry. The message's sequence follows the entry, so publishing
+// it appends to the task's existing log.
+func NewWithEntry(ent *worklog.Entry) *Message {
+	return &Message{
+		Id:       ent.TaskId,
+		Seq:      ent.TaskSeq + 1,
+		Type:     Managed,
+		UTD:      ent.UTD,
+		Data:     ent.Data,
+		Attrs:    ent.Attrs,
+		Triggers: ent.Triggers,
+		Workflow: ent.Workflow,
+	}
+}
+
 func Parse(m *queue.Message) (*Message, error) {
 	// if we are using inline encoding, we decode the message from the
 	// queue payload; otherwise we extract headers
@@ -95,6 +127,46 @@ func (m *Message) SetTriggers(t worklog.Triggers) *Message {
 	return m
 }
 
+func (m *Message) SetWorkflow(w *worklog.Workflow) *Message {
+	m.Workflow = w
+	return m
+}
+
+func (m *Message) SetNotBefore(t time.Time) *Message {
+	m.NotBefore = &t
+	return m
+}
+
+// Due determines if the message may be run as of the provided time.
+func (m *Message) Due(when time.Time) bool {
+	return m.NotBefore == nil || !m.NotBefore.After(when)
+}
+
+// SetExpiresAt sets the time after which the task is discarded if it has not
+// yet run. Like other attributes, the expiration is retained if the task is
+// retried or recovered.
+func (m *Message) SetExpiresAt(t time.Time) *Message {
+	return m.SetAttr(worklog.AttrExpiresAt, t.Format(time.RFC3339Nano))
+}
+
+func (m *Message) ExpiresAt() (time.Time, bool) {
+	v, ok := m.Attrs[worklog.AttrExpiresAt]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Expired determines if the message has expired as of the provided time.
+func (m *Message) Expired(when time.Time) bool {
+	t, ok := m.ExpiresAt()
+	return ok && !t.After(when)
+}
+
 func (m *Message) AddTrigger(s worklog.State, utds ...string) *Message {
 	if len(utds) > 0 {
 		if m.Triggers == nil {
@@ -140,6 +212,7 @@ func (m *Message) Entry(state worklog.State, when time.Time) *worklog.Entry {
 		Data:     m.Data,
 		Attrs:    m.Attrs,
 		Triggers: m.Triggers, // we retain triggers in the initial case
+		Workflow: m.Workflow,
 		Created:  when,
 	}
 }
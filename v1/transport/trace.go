@@ -0,0 +1,41 @@
+package transport
+
+import (
+	"context"
+	"maps"
+
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/tracing"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// SetTraceContext records the trace context of the provided context on the
+// message, so that its execution continues the same trace. The context is
+// recorded in the W3C Trace Context attributes worklog.AttrTraceparent and
+// worklog.AttrTracestate. If the context has no trace, the message is left
+// as-is.
+func (m *Message) SetTraceContext(cxt context.Context) *Message {
+	c := make(propagation.MapCarrier)
+	tracing.Inject(cxt, c)
+	if len(c) == 0 {
+		return m
+	}
+	a := maps.Clone(m.Attrs) // attributes may be shared, e.g., with a workflow
+	if a == nil {
+		a = make(attrs.Attributes)
+	}
+	delete(a, worklog.AttrTracestate)
+	for k, v := range c {
+		a[k] = v
+	}
+	m.Attrs = a
+	return m
+}
+
+// TraceContext produces a context which continues the trace recorded on the
+// message, if there is one
+func (m *Message) TraceContext(cxt context.Context) context.Context {
+	return tracing.Extract(cxt, propagation.MapCarrier(m.Attrs))
+}
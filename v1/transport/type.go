@@ -19,6 +19,7 @@ const (
 var types = []Type{
 	Managed,
 	Oneshot,
+	Cronjob,
 }
 
 func ParseType(t string) (Type, error) {
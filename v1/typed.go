@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/bww/go-validate/v1"
+)
+
+// Codec encodes the results and decodes the entities of typed tasks
+type Codec interface {
+	Marshal(any) ([]byte, error)
+	Unmarshal([]byte, any) error
+}
+
+type jsonCodec struct{}
+
+func (c jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (c jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// JSON is the default codec for typed tasks
+var JSON Codec = jsonCodec{}
+
+type TypedConfig struct {
+	Codec Codec // the codec used for entities and results; defaults to JSON
+}
+
+func (c TypedConfig) WithOptions(opts []TypedOption) TypedConfig {
+	for _, opt := range opts {
+		c = opt(c)
+	}
+	return c
+}
+
+type TypedOption func(TypedConfig) TypedConfig
+
+func WithCodec(v Codec) TypedOption {
+	return func(c TypedConfig) TypedConfig {
+		c.Codec = v
+		return c
+	}
+}
+
+// TypedFunc is a task which accepts a decoded entity and produces a result
+// which is encoded on its behalf
+type TypedFunc[In, Out any] func(context.Context, *Request, Params, In) (Out, error)
+
+// Typed adapts a typed function to a task. The request entity is decoded
+// into the input and validated in the same way the task service validates
+// what it receives; the output becomes the state of the result. An empty
+// entity is decoded as the zero value of the input.
+//
+// Only structs and non-nil pointers to them are validated; when the input is
+// a pointer, an empty or null entity produces a nil input which the function
+// must handle.
+//
+// An entity which cannot be decoded or is invalid produces an error which
+// wraps ErrInvalidRequest; when it is invalid, the error also wraps the
+// validation errors, which may be obtained as validate.Errors.
+func Typed[In, Out any](f TypedFunc[In, Out], opts ...TypedOption) Task {
+	conf := TypedConfig{
+		Codec: JSON,
+	}.WithOptions(opts)
+	codec := conf.Codec
+
+	return TaskFunc(func(cxt context.Context, req *Request, params Params) (Result, error) {
+		var in In
+		if len(req.Entity) > 0 {
+			err := codec.Unmarshal(req.Entity, &in)
+			if err != nil {
+				return Result{}, fmt.Errorf("%w: Could not decode entity: %v", ErrInvalidRequest, err)
+			}
+		}
+		if validatable(in) {
+			if errs := validate.New().Validate(in); len(errs) > 0 {
+				return Result{}, fmt.Errorf("%w: %w", ErrInvalidRequest, errs)
+			}
+		}
+
+		out, err := f(cxt, req, params, in)
+		if err != nil {
+			return Result{}, err
+		}
+
+		state, err := codec.Marshal(out)
+		if err != nil {
+			return Result{}, fmt.Errorf("Could not encode result: %w", err)
+		}
+		return Result{State: state}, nil
+	})
+}
+
+// validatable determines if a value can be validated, which is the case for
+// structs and non-nil pointers to them
+func validatable(v any) bool {
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Pointer {
+		if r.IsNil() {
+			return false
+		}
+		r = r.Elem()
+	}
+	return r.Kind() == reflect.Struct
+}
@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/bww/go-validate/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type testInput struct {
+	Name string `json:"name" xml:"name" check:"len(self) > 0" invalid:"Name is required"`
+}
+
+type testOutput struct {
+	Greeting string `json:"greeting" xml:"greeting"`
+}
+
+type xmlCodec struct{}
+
+func (c xmlCodec) Marshal(v any) ([]byte, error)      { return xml.Marshal(v) }
+func (c xmlCodec) Unmarshal(data []byte, v any) error { return xml.Unmarshal(data, v) }
+
+func TestTyped(t *testing.T) {
+	greet := func(cxt context.Context, req *Request, params Params, in testInput) (testOutput, error) {
+		return testOutput{Greeting: "Hello, " + in.Name}, nil
+	}
+	u, err := url.Parse("test://greet")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	task := Typed(greet)
+	res, err := task.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`{"name":"Test"}`)), Params{})
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"greeting":"Hello, Test"}`, string(res.State))
+	}
+
+	_, err = task.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`{bogus`)), Params{})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	_, err = task.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`{"name":""}`)), Params{})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+	var errs validate.Errors
+	if assert.True(t, errors.As(err, &errs)) {
+		assert.Equal(t, []string{"name"}, errs.Fields())
+	}
+
+	task = Typed(greet, WithCodec(xmlCodec{}))
+	res, err = task.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`<testInput><name>Test</name></testInput>`)), Params{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `<testOutput><greeting>Hello, Test</greeting></testOutput>`, string(res.State))
+	}
+
+	// inputs need not be structs
+	echo := Typed(func(cxt context.Context, req *Request, params Params, in string) (string, error) {
+		return in, nil
+	})
+	res, err = echo.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`"hi"`)), Params{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"hi"`, string(res.State))
+	}
+
+	// an empty entity decodes as the zero value, which is then validated
+	_, err = task.Exec(context.Background(), NewRequest(u), Params{})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+
+	// a pointer input is nil for an empty or null entity, which is not validated
+	var inputs []*testInput
+	ptr := Typed(func(cxt context.Context, req *Request, params Params, in *testInput) (bool, error) {
+		inputs = append(inputs, in)
+		return in != nil, nil
+	})
+	for _, e := range [][]byte{nil, []byte(`null`)} {
+		res, err = ptr.Exec(context.Background(), NewRequest(u).WithEntity(e), Params{})
+		if assert.NoError(t, err, string(e)) {
+			assert.Equal(t, `false`, string(res.State))
+		}
+	}
+	res, err = ptr.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`{"name":"Test"}`)), Params{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `true`, string(res.State))
+	}
+	_, err = ptr.Exec(context.Background(), NewRequest(u).WithEntity([]byte(`{"name":""}`)), Params{})
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+	if assert.Len(t, inputs, 3) {
+		assert.Nil(t, inputs[0])
+		assert.Nil(t, inputs[1])
+		assert.Equal(t, &testInput{Name: "Test"}, inputs[2])
+	}
+}
@@ -0,0 +1,111 @@
+package utds
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	wildOne   = "*"
+	wildMulti = "**"
+)
+
+var (
+	ErrInvalidPattern = errors.New("Invalid pattern")
+	ErrWildcard       = errors.New("Pattern contains a wildcard")
+	ErrMissingVar     = errors.New("Missing variable")
+	ErrInvalidVar     = errors.New("Invalid variable")
+)
+
+// isVar determines if a pattern component is a variable, e.g., '{id}', and
+// produces its name if so
+func isVar(c string) (string, bool) {
+	if l := len(c); l > 2 && c[0] == '{' && c[l-1] == '}' {
+		return strings.TrimSpace(c[1 : l-1]), true
+	}
+	return "", false
+}
+
+// expand produces the value of a pattern component: literals are produced
+// verbatim, variables are replaced by their value.
+func expand(c string, vars map[string]string) (string, error) {
+	if c == wildOne || c == wildMulti {
+		return "", ErrWildcard
+	}
+	n, ok := isVar(c)
+	if !ok {
+		return c, nil
+	}
+	v, ok := vars[n]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrMissingVar, n)
+	}
+	if v == "" || strings.Contains(v, "/") {
+		return "", fmt.Errorf("%w: %s: %q", ErrInvalidVar, n, v) // a variable matches exactly one, non-empty, component
+	}
+	return v, nil
+}
+
+// Build produces a UTD from a route pattern, like those used by
+// [github.com/bww/go-tasks/v1/router.Router], by substituting the provided
+// variables for those in the pattern and appending the query, if any.
+//
+//	Build("sync://account/{id}/items", map[string]string{"id": "a b"}, nil) // → sync://account/a%20b/items
+//
+// Values are escaped as necessary and the UTD produced is guaranteed to be
+// matched by the pattern with the same variables. Variables which do not
+// appear in the pattern are ignored. A pattern which contains a wildcard
+// cannot be built.
+func Build(pattern string, vars map[string]string, query url.Values) (string, error) {
+	x := strings.Index(pattern, ":")
+	if x < 1 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPattern, pattern)
+	}
+	u := &url.URL{Scheme: pattern[:x]}
+	s := pattern[x+1:]
+
+	if strings.HasPrefix(s, "//") {
+		s = s[2:]
+		var h string
+		if x := strings.Index(s, "/"); x < 0 {
+			h, s = s, ""
+		} else {
+			h, s = s[:x], s[x:]
+		}
+		v, err := expand(h, vars)
+		if err != nil {
+			return "", err
+		}
+		u.Host = v
+	} else {
+		u.OmitHost = true
+	}
+	if s != "" && !strings.HasPrefix(s, "/") {
+		s = "/" + s
+	}
+
+	p := strings.Split(s, "/")
+	for i, e := range p {
+		v, err := expand(e, vars)
+		if err != nil {
+			return "", err
+		}
+		p[i] = v
+	}
+	u.Path = strings.Join(p, "/")
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+
+	// make sure the UTD we produced is understood as we intended it to be,
+	// which may not be the case if a host variable contains a delimiter
+	utd := u.String()
+	if c, err := url.Parse(utd); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidVar, err)
+	} else if c.Host != u.Host || c.Path != u.Path {
+		return "", fmt.Errorf("%w: %s", ErrInvalidVar, utd)
+	}
+	return utd, nil
+}
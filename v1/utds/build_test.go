@@ -0,0 +1,79 @@
+package utds
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		pattern string
+		vars    map[string]string
+		query   url.Values
+		expect  string
+		err     error
+	}{
+		{
+			"sync://account/{id}/items", map[string]string{"id": "123"}, nil,
+			"sync://account/123/items", nil,
+		},
+		{
+			"sync://account/{id}/items", map[string]string{"id": "a b?c#d%e"}, nil,
+			"sync://account/a%20b%3Fc%23d%25e/items", nil,
+		},
+		{
+			"sync://account/{id}/items", map[string]string{"id": "123", "other": "ignored"}, url.Values{"page": {"2"}, "q": {"a&b"}},
+			"sync://account/123/items?page=2&q=a%26b", nil,
+		},
+		{
+			"sync://{host}/items", map[string]string{"host": "example"}, nil,
+			"sync://example/items", nil,
+		},
+		{
+			"sync:/account/{id}", map[string]string{"id": "123"}, nil,
+			"sync:/account/123", nil,
+		},
+		{
+			"sync:account", nil, nil,
+			"sync:/account", nil,
+		},
+		{
+			"sync://account/{id}/items", nil, nil,
+			"", ErrMissingVar,
+		},
+		{
+			"sync://account/{id}/items", map[string]string{"id": ""}, nil,
+			"", ErrInvalidVar,
+		},
+		{
+			"sync://account/{id}/items", map[string]string{"id": "a/b"}, nil,
+			"", ErrInvalidVar,
+		},
+		{
+			"sync://{host}/items", map[string]string{"host": "a@b"}, nil,
+			"", ErrInvalidVar,
+		},
+		{
+			"sync://account/*", nil, nil,
+			"", ErrWildcard,
+		},
+		{
+			"sync:*", nil, nil,
+			"", ErrWildcard,
+		},
+		{
+			"account/{id}", nil, nil,
+			"", ErrInvalidPattern,
+		},
+	}
+	for _, e := range tests {
+		utd, err := Build(e.pattern, e.vars, e.query)
+		if e.err != nil {
+			assert.ErrorIs(t, err, e.err, e.pattern)
+		} else if assert.NoError(t, err, e.pattern) {
+			assert.Equal(t, e.expect, utd, e.pattern)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bww/go-tasks/v1/transport"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+)
+
+// PublishWorkflow submits a workflow. Identifiers are assigned to the
+// workflow and to any of its steps which do not already have one, and the
+// steps which do not come after any other step are published. The remaining
+// steps are published as their parents complete; see Advance.
+//
+// Every step is a managed task, so a worklog is required.
+func (q *Queue) PublishWorkflow(cxt context.Context, wf *worklog.Workflow, opts ...PublishOption) error {
+	if q.log == nil {
+		return ErrNoWorklog
+	}
+	err := wf.Validate()
+	if err != nil {
+		return err
+	}
+
+	if wf.Id == ident.Zero {
+		wf.Id = ident.New()
+	}
+	for name, step := range wf.Steps {
+		if step.TaskId == ident.Zero {
+			step.TaskId = ident.New()
+			wf.Steps[name] = step
+		}
+	}
+
+	// an idempotency key identifies a single task; it does not apply to the
+	// steps of a workflow, each of which is a distinct task
+	opts = append(opts, WithIdempotencyKey(""))
+	for _, name := range wf.Roots() {
+		err := q.Publish(cxt, transport.NewStep(wf, name), opts...)
+		if err != nil {
+			return fmt.Errorf("Could not publish workflow step: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Advance is invoked once the step of a workflow identified by wf.Step has
+// completed. It publishes each step which comes after it, provided that
+// every other step that step comes after has also completed.
+//
+// Because the last of several parents to complete may not be unique, more
+// than one parent may attempt to publish the same step; only the first
+// succeeds and the others are ignored.
+func (q *Queue) Advance(cxt context.Context, wf *worklog.Workflow) error {
+	if q.log == nil {
+		return ErrNoWorklog
+	}
+	for _, name := range wf.Children(wf.Step) {
+		ready, err := q.ready(cxt, wf, name)
+		if err != nil {
+			return err
+		} else if !ready {
+			continue
+		}
+		err = q.Publish(cxt, transport.NewStep(wf, name))
+		if errors.Is(err, worklog.ErrConflict) {
+			continue // another parent got here first
+		} else if err != nil {
+			return fmt.Errorf("Could not publish workflow step: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ready determines if every parent of the named step has completed
+func (q *Queue) ready(cxt context.Context, wf *worklog.Workflow, name string) (bool, error) {
+	for _, p := range wf.Steps[name].After {
+		if p == wf.Step {
+			continue // this is the step that just completed
+		}
+		ent, err := q.log.FetchLatestEntryForTask(cxt, wf.Steps[p].TaskId)
+		if errors.Is(err, worklog.ErrNotFound) {
+			return false, nil // not yet published
+		} else if err != nil {
+			return false, fmt.Errorf("Could not fetch workflow step: %s: %w", p, err)
+		} else if ent.State != worklog.Complete {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,175 @@
+// Package memory provides an in-memory implementation of the worklog. It is
+// suitable for tests and for deployments where the executor runs in a single
+// process; its contents do not survive a restart.
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+// Worklog is a concurrency-safe, in-memory worklog. Entries for each task are
+// retained in sequence order; every entry stored or returned is a copy, so
+// callers cannot mutate the contents of the log by side effect.
+type Worklog struct {
+	sync.Mutex
+	tasks map[ident.Ident][]*worklog.Entry
+}
+
+func New() *Worklog {
+	return &Worklog{
+		tasks: make(map[ident.Ident][]*worklog.Entry),
+	}
+}
+
+// CreateEntry stores the first entry for a task. If any entry already exists
+// for the task, ErrConflict is returned.
+func (w *Worklog) CreateEntry(cxt context.Context, ent *worklog.Entry) error {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.tasks[ent.TaskId]) > 0 {
+		return worklog.ErrConflict
+	}
+	w.tasks[ent.TaskId] = []*worklog.Entry{copyEntry(ent)}
+	return nil
+}
+
+// StoreEntry appends an entry to the log for its task. The entry's sequence
+// must be greater than that of every entry already stored for the task,
+// otherwise it is stale and ErrConflict is returned.
+func (w *Worklog) StoreEntry(cxt context.Context, ent *worklog.Entry) error {
+	w.Lock()
+	defer w.Unlock()
+	log := w.tasks[ent.TaskId]
+	if l := len(log); l > 0 && log[l-1].TaskSeq >= ent.TaskSeq {
+		return worklog.ErrConflict
+	}
+	w.tasks[ent.TaskId] = append(log, copyEntry(ent))
+	return nil
+}
+
+// RenewEntry updates the expiration of an entry in place. Only the latest
+// entry for a task may be renewed: if it has been superseded by a later
+// sequence ErrConflict is returned, and if it has been resolved ErrResolved is
+// returned.
+func (w *Worklog) RenewEntry(cxt context.Context, ent *worklog.Entry, expires time.Time) (*worklog.Entry, error) {
+	w.Lock()
+	defer w.Unlock()
+	log := w.tasks[ent.TaskId]
+	if indexOf(log, ent.TaskSeq) < 0 {
+		return nil, worklog.ErrNotFound
+	}
+	cur := log[len(log)-1]
+	if cur.TaskSeq != ent.TaskSeq {
+		return nil, worklog.ErrConflict
+	} else if cur.Resolved() {
+		return nil, worklog.ErrResolved
+	}
+	cur.SetExpires(expires)
+	return copyEntry(cur), nil
+}
+
+func (w *Worklog) FetchEntry(cxt context.Context, id ident.Ident, seq int64) (*worklog.Entry, error) {
+	w.Lock()
+	defer w.Unlock()
+	log := w.tasks[id]
+	if x := indexOf(log, seq); x < 0 {
+		return nil, worklog.ErrNotFound
+	} else {
+		return copyEntry(log[x]), nil
+	}
+}
+
+func (w *Worklog) FetchLatestEntryForTask(cxt context.Context, id ident.Ident) (*worklog.Entry, error) {
+	w.Lock()
+	defer w.Unlock()
+	log := w.tasks[id]
+	if l := len(log); l < 1 {
+		return nil, worklog.ErrNotFound
+	} else {
+		return copyEntry(log[l-1]), nil
+	}
+}
+
+func (w *Worklog) FetchEveryEntryForTask(cxt context.Context, id ident.Ident) ([]*worklog.Entry, error) {
+	w.Lock()
+	defer w.Unlock()
+	log := w.tasks[id]
+	res := make([]*worklog.Entry, len(log))
+	for i, e := range log {
+		res[i] = copyEntry(e)
+	}
+	return res, nil
+}
+
+// IterLatestEntryForEveryTask produces the latest entry for every task which
+// satisfies the provided criteria, evaluated as of the time when. Results are
+// ordered by creation time, oldest first.
+func (w *Worklog) IterLatestEntryForEveryTask(cxt context.Context, crit worklog.Criteria, when time.Time) (siter.Iterator[*worklog.Entry], error) {
+	w.Lock()
+	defer w.Unlock()
+	var res []*worklog.Entry
+	for _, log := range w.tasks {
+		if l := len(log); l > 0 && crit.Matches(log[l-1], when) {
+			res = append(res, copyEntry(log[l-1]))
+		}
+	}
+	slices.SortFunc(res, func(a, b *worklog.Entry) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return a.TaskId.Compare(b.TaskId)
+	})
+	if crit.Limit > 0 && len(res) > crit.Limit {
+		res = res[:crit.Limit]
+	}
+	return siter.NewWithSlice(cxt, res), nil
+}
+
+// DeleteEveryEntryForTask removes the entire log for a task. Deleting a task
+// which has no entries is not an error.
+func (w *Worklog) DeleteEveryEntryForTask(cxt context.Context, id ident.Ident) error {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.tasks, id)
+	return nil
+}
+
+func indexOf(log []*worklog.Entry, seq int64) int {
+	for i, e := range log {
+		if e.TaskSeq == seq {
+			return i
+		}
+	}
+	return -1
+}
+
+func copyEntry(ent *worklog.Entry) *worklog.Entry {
+	d := ent.Clone()
+	d.Data = slices.Clone(ent.Data)
+	d.Attrs = maps.Clone(ent.Attrs)
+	d.Error = slices.Clone(ent.Error)
+	if ent.Triggers != nil {
+		d.Triggers = make(worklog.Triggers, len(ent.Triggers))
+		for k, v := range ent.Triggers {
+			d.Triggers[k] = slices.Clone(v)
+		}
+	}
+	if ent.Expires != nil {
+		d.SetExpires(*ent.Expires)
+	}
+	if ent.Workflow != nil {
+		w := *ent.Workflow
+		w.Steps = maps.Clone(ent.Workflow.Steps)
+		d.Workflow = &w
+	}
+	return d
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/worklogtest"
+)
+
+func TestConformance(t *testing.T) {
+	worklogtest.Run(t, func(t *testing.T) worklog.Worklog {
+		return New()
+	})
+}
@@ -12,6 +12,7 @@ import (
 type NextConfig struct {
 	Attrs    attrs.Attributes
 	Triggers Triggers
+	Workflow *Workflow
 }
 
 func (c NextConfig) WithOptions(opts []NextOption) NextConfig {
@@ -37,23 +38,49 @@ func WithTriggers(v Triggers) NextOption {
 	}
 }
 
+func WithWorkflow(v *Workflow) NextOption {
+	return func(c NextConfig) NextConfig {
+		c.Workflow = v
+		return c
+	}
+}
+
 const (
-	AttrRetries = "retries"
+	AttrRetries   = "retries"
+	AttrRecovered = "recovered"  // the number of times a task has been recovered after its lease expired
+	AttrForward   = "forward"    // how the result of a task is forwarded to the tasks it triggers
+	AttrResult    = "result"     // the result of the parent task, when it is forwarded as an attribute but is not an object
+	AttrExpiresAt = "expires_at" // the time after which a task which has not yet run is discarded
+
+	// the key which identifies duplicate submissions of a task
+	AttrIdempotencyKey = "idempotency_key"
+	// the key which limits how many tasks may run at once
+	AttrConcurrencyKey = "concurrency_key"
+
+	// the W3C Trace Context of the publication of a task
+	AttrTraceparent = "traceparent"
+	AttrTracestate  = "tracestate"
+
+	// provenance of a task which was triggered by another
+	AttrParentId    = "parent_id"
+	AttrParentSeq   = "parent_seq"
+	AttrParentState = "parent_state"
 )
 
 type Entry struct {
-	TaskId   ident.Ident
-	TaskSeq  int64
-	State    State
-	StateSeq int64
-	UTD      string
-	Data     []byte
-	Attrs    attrs.Attributes
-	Error    json.RawMessage
-	Triggers Triggers
-	Retry    bool
-	Created  time.Time
-	Expires  *time.Time
+	TaskId   ident.Ident      `json:"task_id"`
+	TaskSeq  int64            `json:"task_seq"`
+	State    State            `json:"state"`
+	StateSeq int64            `json:"state_seq"`
+	UTD      string           `json:"utd"`
+	Data     []byte           `json:"data,omitempty"`
+	Attrs    attrs.Attributes `json:"attrs,omitempty"`
+	Error    json.RawMessage  `json:"error,omitempty"`
+	Triggers Triggers         `json:"triggers,omitempty"`
+	Workflow *Workflow        `json:"workflow,omitempty"`
+	Retry    bool             `json:"retry"`
+	Created  time.Time        `json:"created"`
+	Expires  *time.Time       `json:"expires,omitempty"`
 }
 
 func (e *Entry) Valid(when time.Time) bool {
@@ -70,6 +97,18 @@ func (e *Entry) Resolved() bool {
 	return e.State.Resolved()
 }
 
+// IdempotencyKey produces the idempotency key the task was published with,
+// if any
+func (e *Entry) IdempotencyKey() string {
+	return e.Attrs[AttrIdempotencyKey]
+}
+
+// ConcurrencyKey produces the key which limits how many tasks like this one
+// may run at once, if any
+func (e *Entry) ConcurrencyKey() string {
+	return e.Attrs[AttrConcurrencyKey]
+}
+
 func (e *Entry) Clone() *Entry {
 	d := *e
 	return &d
@@ -78,7 +117,8 @@ func (e *Entry) Clone() *Entry {
 func (e *Entry) Next(s State, d []byte, opts ...NextOption) *Entry {
 	// NOTE: triggers do not inherit; do this explicitly if it's what you want
 	conf := NextConfig{
-		Attrs: e.Attrs,
+		Attrs:    e.Attrs,
+		Workflow: e.Workflow,
 	}.WithOptions(opts)
 	sseq := e.StateSeq
 	if s != e.State {
@@ -93,6 +133,7 @@ func (e *Entry) Next(s State, d []byte, opts ...NextOption) *Entry {
 		Data:     d,
 		Attrs:    conf.Attrs,
 		Triggers: conf.Triggers,
+		Workflow: conf.Workflow,
 		Retry:    e.Retry,
 		Created:  time.Now(),
 	}
@@ -128,6 +169,21 @@ func (e *Entry) SetTriggers(t Triggers) *Entry {
 	return e
 }
 
+func (e *Entry) SetWorkflow(w *Workflow) *Entry {
+	e.Workflow = w
+	return e
+}
+
+// WorkflowId produces the identifier of the workflow the entry belongs to,
+// or the zero identifier if it does not belong to one.
+func (e *Entry) WorkflowId() ident.Ident {
+	if e.Workflow != nil {
+		return e.Workflow.Id
+	} else {
+		return ident.Zero
+	}
+}
+
 func (e *Entry) SetRetry(r bool) *Entry {
 	e.Retry = r
 	return e
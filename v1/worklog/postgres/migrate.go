@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// an arbitrary but stable key used to serialize concurrent migrations
+const migrationLockKey = 0x7461736b73
+
+type migration struct {
+	version int
+	name    string
+	ddl     string
+}
+
+// loadMigrations reads the embedded migrations, which are named with their
+// version as a numeric prefix, e.g., "0001_init.sql", and orders them.
+func loadMigrations() ([]migration, error) {
+	dents, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var res []migration
+	for _, e := range dents {
+		name := e.Name()
+		x := strings.Index(name, "_")
+		if x < 0 {
+			return nil, fmt.Errorf("Invalid migration name: %s", name)
+		}
+		v, err := strconv.Atoi(name[:x])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid migration version: %s: %w", name, err)
+		}
+		ddl, err := migrationsFS.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, migration{version: v, name: name, ddl: string(ddl)})
+	}
+	slices.SortFunc(res, func(a, b migration) int {
+		return a.version - b.version
+	})
+	return res, nil
+}
+
+// Migrate brings the worklog schema up to date by applying every migration
+// which has not yet been applied. Migrations are applied in a single
+// transaction under an advisory lock, so it is safe for every node in a
+// cluster to call this on startup.
+func (w *Worklog) Migrate(cxt context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return fmt.Errorf("Could not load migrations: %w", err)
+	}
+
+	_, err = w.db.ExecContext(cxt, `CREATE TABLE IF NOT EXISTS tasks_worklog_version (
+  version INTEGER PRIMARY KEY,
+  name    TEXT NOT NULL,
+  applied TIMESTAMP WITH TIME ZONE NOT NULL
+)`)
+	if err != nil {
+		return fmt.Errorf("Could not create version table: %w", err)
+	}
+
+	tx, err := w.db.BeginTx(cxt, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(cxt, `SELECT pg_advisory_xact_lock($1)`, migrationLockKey)
+	if err != nil {
+		return fmt.Errorf("Could not obtain migration lock: %w", err)
+	}
+
+	var current int
+	err = tx.QueryRowContext(cxt, `SELECT COALESCE(MAX(version), 0) FROM tasks_worklog_version`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("Could not determine schema version: %w", err)
+	}
+
+	for _, e := range migrations {
+		if e.version <= current {
+			continue
+		}
+		_, err = tx.ExecContext(cxt, e.ddl)
+		if err != nil {
+			return fmt.Errorf("Could not apply migration: %s: %w", e.name, err)
+		}
+		_, err = tx.ExecContext(cxt, `INSERT INTO tasks_worklog_version (version, name, applied) VALUES ($1, $2, $3)`, e.version, e.name, time.Now())
+		if err != nil {
+			return fmt.Errorf("Could not record migration: %s: %w", e.name, err)
+		}
+	}
+
+	return tx.Commit()
+}
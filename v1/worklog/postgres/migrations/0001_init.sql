@@ -0,0 +1,24 @@
+CREATE TABLE tasks_worklog (
+  task_id    VARCHAR(32) NOT NULL,
+  task_seq   BIGINT NOT NULL,
+  state      VARCHAR(32) NOT NULL,
+  state_seq  BIGINT NOT NULL DEFAULT 0,
+  utd        TEXT NOT NULL,
+  data       BYTEA,
+  attrs      JSONB,
+  error      JSONB,
+  triggers   JSONB,
+  retry      BOOLEAN NOT NULL DEFAULT FALSE,
+  latest     BOOLEAN NOT NULL DEFAULT TRUE,
+  created    TIMESTAMP WITH TIME ZONE NOT NULL,
+  expires    TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY (task_id, task_seq)
+);
+
+-- Only one entry per task may be the latest; this guards against concurrent
+-- writers both appending to the same task
+CREATE UNIQUE INDEX tasks_worklog_latest_idx ON tasks_worklog (task_id) WHERE latest;
+
+-- Support criteria evaluated over the latest entry for every task
+CREATE INDEX tasks_worklog_latest_state_idx ON tasks_worklog (state, expires) WHERE latest;
+CREATE INDEX tasks_worklog_latest_created_idx ON tasks_worklog (created) WHERE latest;
@@ -0,0 +1,5 @@
+ALTER TABLE tasks_worklog ADD COLUMN workflow_id VARCHAR(32);
+ALTER TABLE tasks_worklog ADD COLUMN workflow JSONB;
+
+-- Support listing the tasks which belong to a workflow
+CREATE INDEX tasks_worklog_latest_workflow_idx ON tasks_worklog (workflow_id) WHERE latest AND workflow_id IS NOT NULL;
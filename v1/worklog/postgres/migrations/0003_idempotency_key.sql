@@ -0,0 +1,4 @@
+ALTER TABLE tasks_worklog ADD COLUMN idempotency_key TEXT;
+
+-- Support finding the task which was published with an idempotency key
+CREATE INDEX tasks_worklog_latest_idempotency_key_idx ON tasks_worklog (idempotency_key) WHERE latest AND idempotency_key IS NOT NULL;
@@ -0,0 +1,317 @@
+// Package postgres provides a worklog backed by PostgreSQL via database/sql.
+// It does not import a driver; callers are expected to open the database
+// with the driver of their choice. Use Migrate to create or update the
+// schema before the worklog is used.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
+)
+
+const entryColumns = `task_id, task_seq, state, state_seq, utd, data, attrs, error, triggers, retry, created, expires, workflow`
+
+// the SQLSTATE code for a unique constraint violation
+const uniqueViolation = "23505"
+
+type sqlStateError interface {
+	SQLState() string
+}
+
+func isUniqueViolation(err error) bool {
+	var e sqlStateError
+	return errors.As(err, &e) && e.SQLState() == uniqueViolation
+}
+
+type scanner interface {
+	Scan(...any) error
+}
+
+type Worklog struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Worklog {
+	return &Worklog{db: db}
+}
+
+// CreateEntry stores the first entry for a task. If any entry already exists
+// for the task, ErrConflict is returned.
+func (w *Worklog) CreateEntry(cxt context.Context, ent *worklog.Entry) error {
+	err := insertEntry(cxt, w.db, ent)
+	if isUniqueViolation(err) {
+		return worklog.ErrConflict
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// StoreEntry appends an entry to the log for its task. The entry's sequence
+// must be greater than that of every entry already stored for the task,
+// otherwise it is stale and ErrConflict is returned.
+func (w *Worklog) StoreEntry(cxt context.Context, ent *worklog.Entry) error {
+	tx, err := w.db.BeginTx(cxt, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var seq int64
+	err = tx.QueryRowContext(cxt, `SELECT task_seq FROM tasks_worklog WHERE task_id = $1 AND latest FOR UPDATE`, ent.TaskId).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		// no entries yet; nothing to supersede
+	} else if err != nil {
+		return err
+	} else if seq >= ent.TaskSeq {
+		return worklog.ErrConflict
+	} else {
+		_, err = tx.ExecContext(cxt, `UPDATE tasks_worklog SET latest = FALSE WHERE task_id = $1 AND latest`, ent.TaskId)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertEntry(cxt, tx, ent)
+	if isUniqueViolation(err) {
+		return worklog.ErrConflict
+	} else if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if isUniqueViolation(err) {
+		return worklog.ErrConflict
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RenewEntry updates the expiration of an entry in place. Only the latest
+// entry for a task may be renewed: if it has been superseded by a later
+// sequence ErrConflict is returned, and if it has been resolved ErrResolved is
+// returned.
+func (w *Worklog) RenewEntry(cxt context.Context, ent *worklog.Entry, expires time.Time) (*worklog.Entry, error) {
+	args := []any{ent.TaskId, ent.TaskSeq, expires}
+	resolved := make([]string, 0, len(worklog.ResolvedStates()))
+	for _, e := range worklog.ResolvedStates() {
+		args = append(args, e)
+		resolved = append(resolved, "$"+strconv.Itoa(len(args)))
+	}
+	res, err := scanEntry(w.db.QueryRowContext(cxt, `UPDATE tasks_worklog SET expires = $3 WHERE task_id = $1 AND task_seq = $2 AND latest AND state NOT IN (`+strings.Join(resolved, ", ")+`) RETURNING `+entryColumns, args...))
+	if err == nil {
+		return res, nil
+	} else if !errors.Is(err, worklog.ErrNotFound) {
+		return nil, err
+	}
+
+	// nothing was updated; determine why
+	var (
+		latest bool
+		state  worklog.State
+	)
+	err = w.db.QueryRowContext(cxt, `SELECT latest, state FROM tasks_worklog WHERE task_id = $1 AND task_seq = $2`, ent.TaskId, ent.TaskSeq).Scan(&latest, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, worklog.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	} else if !latest {
+		return nil, worklog.ErrConflict
+	} else {
+		return nil, worklog.ErrResolved
+	}
+}
+
+func (w *Worklog) FetchEntry(cxt context.Context, id ident.Ident, seq int64) (*worklog.Entry, error) {
+	return scanEntry(w.db.QueryRowContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = $1 AND task_seq = $2`, id, seq))
+}
+
+func (w *Worklog) FetchLatestEntryForTask(cxt context.Context, id ident.Ident) (*worklog.Entry, error) {
+	return scanEntry(w.db.QueryRowContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = $1 AND latest`, id))
+}
+
+func (w *Worklog) FetchEveryEntryForTask(cxt context.Context, id ident.Ident) ([]*worklog.Entry, error) {
+	rows, err := w.db.QueryContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = $1 ORDER BY task_seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*worklog.Entry
+	for rows.Next() {
+		ent, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// IterLatestEntryForEveryTask produces the latest entry for every task which
+// satisfies the provided criteria, evaluated as of the time when. Results are
+// ordered by creation time, oldest first.
+func (w *Worklog) IterLatestEntryForEveryTask(cxt context.Context, crit worklog.Criteria, when time.Time) (siter.Iterator[*worklog.Entry], error) {
+	where, args := criteriaClause(crit, when)
+	query := `SELECT ` + entryColumns + ` FROM tasks_worklog WHERE ` + where + ` ORDER BY created, task_id`
+	if crit.Limit > 0 {
+		args = append(args, crit.Limit)
+		query += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+	rows, err := w.db.QueryContext(cxt, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*worklog.Entry
+	for rows.Next() {
+		ent, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return siter.NewWithSlice(cxt, res), nil
+}
+
+// DeleteEveryEntryForTask removes the entire log for a task. Deleting a task
+// which has no entries is not an error.
+func (w *Worklog) DeleteEveryEntryForTask(cxt context.Context, id ident.Ident) error {
+	_, err := w.db.ExecContext(cxt, `DELETE FROM tasks_worklog WHERE task_id = $1`, id)
+	return err
+}
+
+type execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}
+
+func insertEntry(cxt context.Context, db execer, ent *worklog.Entry) error {
+	_, err := db.ExecContext(cxt, `INSERT INTO tasks_worklog (`+entryColumns+`, workflow_id, idempotency_key, concurrency_key, latest) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, TRUE)`,
+		ent.TaskId,
+		ent.TaskSeq,
+		ent.State,
+		ent.StateSeq,
+		ent.UTD,
+		ent.Data,
+		ent.Attrs,
+		[]byte(ent.Error),
+		ent.Triggers,
+		ent.Retry,
+		ent.Created,
+		ent.Expires,
+		ent.Workflow,
+		ent.WorkflowId(),
+		sql.NullString{String: ent.IdempotencyKey(), Valid: ent.IdempotencyKey() != ""},
+		sql.NullString{String: ent.ConcurrencyKey(), Valid: ent.ConcurrencyKey() != ""},
+	)
+	return err
+}
+
+func scanEntry(row scanner) (*worklog.Entry, error) {
+	var (
+		ent     worklog.Entry
+		errdat  []byte
+		wfdat   []byte
+		expires sql.NullTime
+	)
+	err := row.Scan(
+		&ent.TaskId,
+		&ent.TaskSeq,
+		&ent.State,
+		&ent.StateSeq,
+		&ent.UTD,
+		&ent.Data,
+		&ent.Attrs,
+		&errdat,
+		&ent.Triggers,
+		&ent.Retry,
+		&ent.Created,
+		&expires,
+		&wfdat,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, worklog.ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not scan worklog entry: %w", err)
+	}
+	if len(errdat) > 0 {
+		ent.Error = errdat
+	}
+	if len(wfdat) > 0 {
+		ent.Workflow = &worklog.Workflow{}
+		err = json.Unmarshal(wfdat, ent.Workflow)
+		if err != nil {
+			return nil, fmt.Errorf("Could not unmarshal worklog workflow: %w", err)
+		}
+	}
+	if expires.Valid {
+		ent.SetExpires(expires.Time)
+	}
+	return &ent, nil
+}
+
+// criteriaClause produces a WHERE clause and its arguments which select the
+// latest entry for every task that satisfies the provided criteria.
+func criteriaClause(crit worklog.Criteria, when time.Time) (string, []any) {
+	var (
+		where = []string{"latest"}
+		args  []any
+	)
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	states := func(s []worklog.State) string {
+		p := make([]string, len(s))
+		for i, e := range s {
+			p[i] = param(e)
+		}
+		return "(" + strings.Join(p, ", ") + ")"
+	}
+	if crit.Expired {
+		where = append(where, "state NOT IN "+states(worklog.ResolvedStates()), "expires IS NOT NULL", "expires <= "+param(when))
+	}
+	if crit.Resolved {
+		where = append(where, "state IN "+states(worklog.ResolvedStates()))
+	}
+	if !crit.IdleSince.IsZero() {
+		where = append(where, "created <= "+param(crit.IdleSince))
+	}
+	if !crit.ActiveSince.IsZero() {
+		where = append(where, "created >= "+param(crit.ActiveSince))
+	}
+	if len(crit.States) > 0 {
+		where = append(where, "state IN "+states(crit.States))
+	}
+	if crit.Workflow != ident.Zero {
+		where = append(where, "workflow_id = "+param(crit.Workflow))
+	}
+	if crit.Key != "" {
+		where = append(where, "idempotency_key = "+param(crit.Key))
+	}
+	if crit.ConcurrencyKey != "" {
+		where = append(where, "concurrency_key = "+param(crit.ConcurrencyKey))
+	}
+	return strings.Join(where, " AND "), args
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/worklogtest"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests which require a database are skipped unless a DSN is provided, e.g.:
+//
+//	WORKLOG_POSTGRES_DSN="postgres://postgres@localhost/tasks_test?sslmode=disable" go test ./...
+const dsnEnv = "WORKLOG_POSTGRES_DSN"
+
+func testWorklog(t *testing.T) *Worklog {
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set; skipping", dsnEnv)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db.Close() })
+	wl := New(db)
+	if !assert.NoError(t, wl.Migrate(context.Background())) {
+		t.FailNow()
+	}
+	return wl
+}
+
+func TestCriteriaClause(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		crit  worklog.Criteria
+		where string
+		args  []any
+	}{
+		{
+			worklog.Criteria{},
+			"latest", nil,
+		},
+		{
+			worklog.Criteria{Expired: true},
+			"latest AND state NOT IN ($1, $2, $3, $4) AND expires IS NOT NULL AND expires <= $5",
+			[]any{worklog.Complete, worklog.Canceled, worklog.Failed, worklog.Lapsed, now},
+		},
+		{
+			worklog.Criteria{States: []worklog.State{worklog.Pending}, ActiveSince: now},
+			"latest AND created >= $1 AND state IN ($2)",
+			[]any{now, worklog.Pending},
+		},
+		{
+			worklog.Criteria{States: []worklog.State{worklog.Pending, worklog.Running}, Key: "abc"},
+			"latest AND state IN ($1, $2) AND idempotency_key = $3",
+			[]any{worklog.Pending, worklog.Running, "abc"},
+		},
+		{
+			worklog.Criteria{States: []worklog.State{worklog.Running}, ConcurrencyKey: "test://a"},
+			"latest AND state IN ($1) AND concurrency_key = $2",
+			[]any{worklog.Running, "test://a"},
+		},
+	}
+	for _, e := range tests {
+		where, args := criteriaClause(e.crit, now)
+		assert.Equal(t, e.where, where)
+		assert.Equal(t, e.args, args)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	wl := testWorklog(t)
+	worklogtest.Run(t, func(t *testing.T) worklog.Worklog {
+		return wl
+	})
+}
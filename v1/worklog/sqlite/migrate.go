@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+type migration struct {
+	version int
+	name    string
+	ddl     string
+}
+
+// loadMigrations reads the embedded migrations, which are named with their
+// version as a numeric prefix, e.g., "0001_init.sql", and orders them.
+func loadMigrations() ([]migration, error) {
+	dents, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var res []migration
+	for _, e := range dents {
+		name := e.Name()
+		x := strings.Index(name, "_")
+		if x < 0 {
+			return nil, fmt.Errorf("Invalid migration name: %s", name)
+		}
+		v, err := strconv.Atoi(name[:x])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid migration version: %s: %w", name, err)
+		}
+		ddl, err := migrationsFS.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, migration{version: v, name: name, ddl: string(ddl)})
+	}
+	slices.SortFunc(res, func(a, b migration) int {
+		return a.version - b.version
+	})
+	return res, nil
+}
+
+// Migrate brings the worklog schema up to date by applying every migration
+// which has not yet been applied. The schema version is tracked in the
+// database's user_version and migrations are applied in a single
+// transaction.
+func (w *Worklog) Migrate(cxt context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return fmt.Errorf("Could not load migrations: %w", err)
+	}
+
+	tx, err := w.db.BeginTx(cxt, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRowContext(cxt, `PRAGMA user_version`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("Could not determine schema version: %w", err)
+	}
+
+	for _, e := range migrations {
+		if e.version <= current {
+			continue
+		}
+		_, err = tx.ExecContext(cxt, e.ddl)
+		if err != nil {
+			return fmt.Errorf("Could not apply migration: %s: %w", e.name, err)
+		}
+		// pragmas cannot be parameterized; the version is an integer we produced
+		_, err = tx.ExecContext(cxt, `PRAGMA user_version = `+strconv.Itoa(e.version))
+		if err != nil {
+			return fmt.Errorf("Could not record migration: %s: %w", e.name, err)
+		}
+	}
+
+	return tx.Commit()
+}
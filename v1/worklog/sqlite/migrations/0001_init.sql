@@ -0,0 +1,24 @@
+CREATE TABLE tasks_worklog (
+  task_id    TEXT NOT NULL,
+  task_seq   INTEGER NOT NULL,
+  state      TEXT NOT NULL,
+  state_seq  INTEGER NOT NULL DEFAULT 0,
+  utd        TEXT NOT NULL,
+  data       BLOB,
+  attrs      TEXT,
+  error      TEXT,
+  triggers   TEXT,
+  retry      INTEGER NOT NULL DEFAULT 0,
+  latest     INTEGER NOT NULL DEFAULT 1,
+  created    INTEGER NOT NULL, -- unix time, in nanoseconds
+  expires    INTEGER,          -- unix time, in nanoseconds
+  PRIMARY KEY (task_id, task_seq)
+);
+
+-- Only one entry per task may be the latest; this guards against concurrent
+-- writers both appending to the same task
+CREATE UNIQUE INDEX tasks_worklog_latest_idx ON tasks_worklog (task_id) WHERE latest;
+
+-- Support criteria evaluated over the latest entry for every task
+CREATE INDEX tasks_worklog_latest_state_idx ON tasks_worklog (state, expires) WHERE latest;
+CREATE INDEX tasks_worklog_latest_created_idx ON tasks_worklog (created) WHERE latest;
@@ -0,0 +1,4 @@
+ALTER TABLE tasks_worklog ADD COLUMN concurrency_key TEXT;
+
+-- Support counting the running tasks which share a concurrency key
+CREATE INDEX tasks_worklog_latest_concurrency_key_idx ON tasks_worklog (concurrency_key, state) WHERE latest AND concurrency_key IS NOT NULL;
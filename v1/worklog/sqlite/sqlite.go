@@ -0,0 +1,353 @@
+// Package sqlite provides a worklog backed by an embedded SQLite database.
+// It is intended for single-node deployments which need the worklog to
+// survive a restart but do not want to operate a database server.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/mattn/go-sqlite3"
+)
+
+const entryColumns = `task_id, task_seq, state, state_seq, utd, data, attrs, error, triggers, retry, created, expires, workflow`
+
+func isUniqueViolation(err error) bool {
+	var e sqlite3.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+type scanner interface {
+	Scan(...any) error
+}
+
+type execer interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}
+
+type Worklog struct {
+	db *sql.DB
+}
+
+// Open opens (creating, if necessary) the SQLite database at the provided
+// path and brings its schema up to date. The database is configured so that
+// transactions obtain the write lock immediately, which is required for
+// sequence conflicts to be detected reliably between concurrent writers.
+func Open(cxt context.Context, path string) (*Worklog, error) {
+	params := url.Values{
+		"_txlock":       []string{"immediate"},
+		"_busy_timeout": []string{"5000"},
+		"_journal_mode": []string{"WAL"},
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	w := New(db)
+	err = w.Migrate(cxt)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// New creates a worklog with a database that has already been opened. The
+// database should have been opened with the "_txlock=immediate" parameter.
+func New(db *sql.DB) *Worklog {
+	return &Worklog{db: db}
+}
+
+// Close closes the underlying database.
+func (w *Worklog) Close() error {
+	return w.db.Close()
+}
+
+// CreateEntry stores the first entry for a task. If any entry already exists
+// for the task, ErrConflict is returned.
+func (w *Worklog) CreateEntry(cxt context.Context, ent *worklog.Entry) error {
+	err := insertEntry(cxt, w.db, ent)
+	if isUniqueViolation(err) {
+		return worklog.ErrConflict
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// StoreEntry appends an entry to the log for its task. The entry's sequence
+// must be greater than that of every entry already stored for the task,
+// otherwise it is stale and ErrConflict is returned.
+func (w *Worklog) StoreEntry(cxt context.Context, ent *worklog.Entry) error {
+	tx, err := w.db.BeginTx(cxt, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var seq int64
+	err = tx.QueryRowContext(cxt, `SELECT task_seq FROM tasks_worklog WHERE task_id = ? AND latest`, ent.TaskId).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		// no entries yet; nothing to supersede
+	} else if err != nil {
+		return err
+	} else if seq >= ent.TaskSeq {
+		return worklog.ErrConflict
+	} else {
+		_, err = tx.ExecContext(cxt, `UPDATE tasks_worklog SET latest = 0 WHERE task_id = ? AND latest`, ent.TaskId)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = insertEntry(cxt, tx, ent)
+	if isUniqueViolation(err) {
+		return worklog.ErrConflict
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RenewEntry updates the expiration of an entry in place. Only the latest
+// entry for a task may be renewed: if it has been superseded by a later
+// sequence ErrConflict is returned, and if it has been resolved ErrResolved is
+// returned.
+func (w *Worklog) RenewEntry(cxt context.Context, ent *worklog.Entry, expires time.Time) (*worklog.Entry, error) {
+	tx, err := w.db.BeginTx(cxt, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		latest bool
+		state  worklog.State
+	)
+	err = tx.QueryRowContext(cxt, `SELECT latest, state FROM tasks_worklog WHERE task_id = ? AND task_seq = ?`, ent.TaskId, ent.TaskSeq).Scan(&latest, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, worklog.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	} else if !latest {
+		return nil, worklog.ErrConflict
+	} else if state.Resolved() {
+		return nil, worklog.ErrResolved
+	}
+
+	_, err = tx.ExecContext(cxt, `UPDATE tasks_worklog SET expires = ? WHERE task_id = ? AND task_seq = ?`, expires.UnixNano(), ent.TaskId, ent.TaskSeq)
+	if err != nil {
+		return nil, err
+	}
+	res, err := scanEntry(tx.QueryRowContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = ? AND task_seq = ?`, ent.TaskId, ent.TaskSeq))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (w *Worklog) FetchEntry(cxt context.Context, id ident.Ident, seq int64) (*worklog.Entry, error) {
+	return scanEntry(w.db.QueryRowContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = ? AND task_seq = ?`, id, seq))
+}
+
+func (w *Worklog) FetchLatestEntryForTask(cxt context.Context, id ident.Ident) (*worklog.Entry, error) {
+	return scanEntry(w.db.QueryRowContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = ? AND latest`, id))
+}
+
+func (w *Worklog) FetchEveryEntryForTask(cxt context.Context, id ident.Ident) ([]*worklog.Entry, error) {
+	rows, err := w.db.QueryContext(cxt, `SELECT `+entryColumns+` FROM tasks_worklog WHERE task_id = ? ORDER BY task_seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*worklog.Entry
+	for rows.Next() {
+		ent, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// IterLatestEntryForEveryTask produces the latest entry for every task which
+// satisfies the provided criteria, evaluated as of the time when. Results are
+// ordered by creation time, oldest first.
+func (w *Worklog) IterLatestEntryForEveryTask(cxt context.Context, crit worklog.Criteria, when time.Time) (siter.Iterator[*worklog.Entry], error) {
+	where, args := criteriaClause(crit, when)
+	query := `SELECT ` + entryColumns + ` FROM tasks_worklog WHERE ` + where + ` ORDER BY created, task_id`
+	if crit.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, crit.Limit)
+	}
+	rows, err := w.db.QueryContext(cxt, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []*worklog.Entry
+	for rows.Next() {
+		ent, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return siter.NewWithSlice(cxt, res), nil
+}
+
+// DeleteEveryEntryForTask removes the entire log for a task. Deleting a task
+// which has no entries is not an error.
+func (w *Worklog) DeleteEveryEntryForTask(cxt context.Context, id ident.Ident) error {
+	_, err := w.db.ExecContext(cxt, `DELETE FROM tasks_worklog WHERE task_id = ?`, id)
+	return err
+}
+
+func insertEntry(cxt context.Context, db execer, ent *worklog.Entry) error {
+	var expires sql.NullInt64
+	if x := ent.Expires; x != nil {
+		expires = sql.NullInt64{Int64: x.UnixNano(), Valid: true}
+	}
+	_, err := db.ExecContext(cxt, `INSERT INTO tasks_worklog (`+entryColumns+`, workflow_id, idempotency_key, concurrency_key, latest) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+		ent.TaskId,
+		ent.TaskSeq,
+		ent.State,
+		ent.StateSeq,
+		ent.UTD,
+		ent.Data,
+		ent.Attrs,
+		[]byte(ent.Error),
+		ent.Triggers,
+		ent.Retry,
+		ent.Created.UnixNano(),
+		expires,
+		ent.Workflow,
+		ent.WorkflowId(),
+		sql.NullString{String: ent.IdempotencyKey(), Valid: ent.IdempotencyKey() != ""},
+		sql.NullString{String: ent.ConcurrencyKey(), Valid: ent.ConcurrencyKey() != ""},
+	)
+	return err
+}
+
+func scanEntry(row scanner) (*worklog.Entry, error) {
+	var (
+		ent     worklog.Entry
+		errdat  []byte
+		wfdat   []byte
+		created int64
+		expires sql.NullInt64
+	)
+	err := row.Scan(
+		&ent.TaskId,
+		&ent.TaskSeq,
+		&ent.State,
+		&ent.StateSeq,
+		&ent.UTD,
+		&ent.Data,
+		&ent.Attrs,
+		&errdat,
+		&ent.Triggers,
+		&ent.Retry,
+		&created,
+		&expires,
+		&wfdat,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, worklog.ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not scan worklog entry: %w", err)
+	}
+	if len(errdat) > 0 {
+		ent.Error = errdat
+	}
+	if len(wfdat) > 0 {
+		ent.Workflow = &worklog.Workflow{}
+		err = json.Unmarshal(wfdat, ent.Workflow)
+		if err != nil {
+			return nil, fmt.Errorf("Could not unmarshal worklog workflow: %w", err)
+		}
+	}
+	ent.Created = time.Unix(0, created)
+	if expires.Valid {
+		ent.SetExpires(time.Unix(0, expires.Int64))
+	}
+	return &ent, nil
+}
+
+// criteriaClause produces a WHERE clause and its arguments which select the
+// latest entry for every task that satisfies the provided criteria.
+func criteriaClause(crit worklog.Criteria, when time.Time) (string, []any) {
+	var (
+		where = []string{"latest"}
+		args  []any
+	)
+	states := func(s []worklog.State) string {
+		p := make([]string, len(s))
+		for i, e := range s {
+			p[i] = "?"
+			args = append(args, e)
+		}
+		return "(" + strings.Join(p, ", ") + ")"
+	}
+	if crit.Expired {
+		where = append(where, "state NOT IN "+states(worklog.ResolvedStates()), "expires IS NOT NULL", "expires <= ?")
+		args = append(args, when.UnixNano())
+	}
+	if crit.Resolved {
+		where = append(where, "state IN "+states(worklog.ResolvedStates()))
+	}
+	if !crit.IdleSince.IsZero() {
+		where = append(where, "created <= ?")
+		args = append(args, crit.IdleSince.UnixNano())
+	}
+	if !crit.ActiveSince.IsZero() {
+		where = append(where, "created >= ?")
+		args = append(args, crit.ActiveSince.UnixNano())
+	}
+	if len(crit.States) > 0 {
+		where = append(where, "state IN "+states(crit.States))
+	}
+	if crit.Workflow != ident.Zero {
+		where = append(where, "workflow_id = ?")
+		args = append(args, crit.Workflow)
+	}
+	if crit.Key != "" {
+		where = append(where, "idempotency_key = ?")
+		args = append(args, crit.Key)
+	}
+	if crit.ConcurrencyKey != "" {
+		where = append(where, "concurrency_key = ?")
+		args = append(args, crit.ConcurrencyKey)
+	}
+	return strings.Join(where, " AND "), args
+}
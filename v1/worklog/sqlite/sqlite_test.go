@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1/worklog"
+	"github.com/bww/go-tasks/v1/worklog/worklogtest"
+
+	"github.com/bww/go-ident/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConformance(t *testing.T) {
+	wl, err := Open(context.Background(), filepath.Join(t.TempDir(), "worklog.db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer wl.Close()
+	worklogtest.Run(t, func(t *testing.T) worklog.Worklog {
+		return wl
+	})
+}
+
+func TestRestart(t *testing.T) {
+	cxt := context.Background()
+	path := filepath.Join(t.TempDir(), "worklog.db")
+	now := time.Now()
+
+	wl, err := Open(cxt, path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ent := &worklog.Entry{TaskId: ident.New(), State: worklog.Pending, UTD: "foo://bar", Attrs: map[string]string{"a": "b"}, Created: now}
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+	run := ent.Next(worklog.Running, []byte("data")).SetExpires(now.Add(time.Minute))
+	assert.NoError(t, wl.StoreEntry(cxt, run))
+	assert.NoError(t, wl.Close())
+
+	// reopening the database must preserve state and re-running migrations
+	// must be a no-op
+	wl, err = Open(cxt, path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer wl.Close()
+
+	assert.ErrorIs(t, wl.CreateEntry(cxt, ent), worklog.ErrConflict)
+	assert.ErrorIs(t, wl.StoreEntry(cxt, run), worklog.ErrConflict)
+
+	lst, err := wl.FetchLatestEntryForTask(cxt, ent.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, worklog.Running, lst.State)
+		assert.Equal(t, []byte("data"), lst.Data)
+		assert.Equal(t, "b", lst.Attrs["a"])
+		assert.True(t, run.Created.Equal(lst.Created))
+		assert.True(t, lst.Valid(now))
+		assert.False(t, lst.Valid(now.Add(time.Hour)))
+	}
+
+	it, err := wl.IterLatestEntryForEveryTask(cxt, worklog.Criteria{Expired: true}, now.Add(time.Hour))
+	if assert.NoError(t, err) {
+		exp, err := it.Next()
+		if assert.NoError(t, err) {
+			assert.Equal(t, run.TaskSeq, exp.TaskSeq)
+		}
+	}
+
+	done := run.Next(worklog.Complete, nil)
+	assert.NoError(t, wl.StoreEntry(cxt, done))
+	_, err = wl.RenewEntry(cxt, run, now.Add(time.Hour))
+	assert.ErrorIs(t, err, worklog.ErrConflict)
+	_, err = wl.RenewEntry(cxt, done, now.Add(time.Hour))
+	assert.ErrorIs(t, err, worklog.ErrResolved)
+}
@@ -16,6 +16,7 @@ const (
 	Complete = State("complete")
 	Canceled = State("canceled")
 	Failed   = State("failed")
+	Lapsed   = State("lapsed") // the task expired before it could be run; not to be confused with an entry which has expired, see Criteria.Expired
 	Unknown  = State("unknown")
 )
 
@@ -25,6 +26,7 @@ var ordinals = map[State]int{
 	Complete: 2,
 	Canceled: 3,
 	Failed:   4,
+	Lapsed:   5,
 	Unknown:  -1,
 }
 
@@ -34,6 +36,7 @@ var states = map[State]string{
 	Complete: "Complete",
 	Canceled: "Canceled",
 	Failed:   "Failed",
+	Lapsed:   "Lapsed",
 	Unknown:  "Unknown",
 }
 
@@ -41,6 +44,7 @@ var resolvedStates = []State{
 	Complete,
 	Canceled,
 	Failed,
+	Lapsed,
 }
 
 func ResolvedStates() []State {
@@ -83,7 +87,7 @@ func (s State) After(another State) bool {
 
 func (s State) Resolved() bool {
 	switch s {
-	case Complete, Canceled, Failed:
+	case Complete, Canceled, Failed, Lapsed:
 		return true
 	default:
 		return false
@@ -92,7 +96,7 @@ func (s State) Resolved() bool {
 
 func (s State) Failure() bool {
 	switch s {
-	case Canceled, Failed:
+	case Canceled, Failed, Lapsed:
 		return true
 	default:
 		return false
@@ -0,0 +1,169 @@
+package worklog
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/bww/go-ident/v1"
+	"github.com/bww/go-tasks/v1/attrs"
+)
+
+var (
+	ErrInvalidWorkflow = errors.New("Invalid workflow")
+	ErrCyclicWorkflow  = errors.New("Workflow contains a cycle")
+)
+
+// Step is a task in a workflow. A step runs once every step it comes after
+// has completed; a step which comes after nothing runs when the workflow is
+// submitted.
+type Step struct {
+	TaskId ident.Ident      `json:"task_id"`
+	UTD    string           `json:"utd"`
+	Data   []byte           `json:"data,omitempty"`
+	Attrs  attrs.Attributes `json:"attrs,omitempty"`
+	After  []string         `json:"after,omitempty"`
+}
+
+// Workflow describes a graph of tasks, the steps, which may fan out to run in
+// parallel and fan in to a step which runs only once all of its parents have
+// completed. Every task in a workflow carries the workflow, with Step set to
+// the name of the step that task performs, so that its dependents can be
+// determined when it completes.
+type Workflow struct {
+	Id    ident.Ident     `json:"id"`
+	Step  string          `json:"step,omitempty"`
+	Steps map[string]Step `json:"steps"`
+}
+
+func NewWorkflow() *Workflow {
+	return &Workflow{
+		Steps: make(map[string]Step),
+	}
+}
+
+// AddStep adds a named step to the workflow which runs after the named
+// parent steps have completed.
+func (w *Workflow) AddStep(name, utd string, data []byte, after ...string) *Workflow {
+	return w.SetStep(name, Step{UTD: utd, Data: data, After: after})
+}
+
+func (w *Workflow) SetStep(name string, s Step) *Workflow {
+	if w.Steps == nil {
+		w.Steps = make(map[string]Step)
+	}
+	w.Steps[name] = s
+	return w
+}
+
+// Validate checks that the workflow is well-formed: it has at least one step,
+// every step has a UTD, every parent refers to a step which exists, and there
+// are no cycles.
+func (w *Workflow) Validate() error {
+	if len(w.Steps) < 1 {
+		return fmt.Errorf("%w: No steps", ErrInvalidWorkflow)
+	}
+	for name, s := range w.Steps {
+		if s.UTD == "" {
+			return fmt.Errorf("%w: Step has no UTD: %s", ErrInvalidWorkflow, name)
+		}
+		for _, p := range s.After {
+			if _, ok := w.Steps[p]; !ok {
+				return fmt.Errorf("%w: Step %s comes after undefined step: %s", ErrInvalidWorkflow, name, p)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make(map[string]int)
+	var visit func(string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("%w: %s", ErrCyclicWorkflow, name)
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, p := range w.Steps[name].After {
+			if err := visit(p); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+	for _, name := range w.names() {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// names produces the names of every step, ordered so that results are stable
+func (w *Workflow) names() []string {
+	return slices.Sorted(maps.Keys(w.Steps))
+}
+
+// Roots produces the names of the steps which do not come after any other
+// step; these run when the workflow is submitted.
+func (w *Workflow) Roots() []string {
+	var res []string
+	for _, name := range w.names() {
+		if len(w.Steps[name].After) == 0 {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// Children produces the names of the steps which come after the named step.
+func (w *Workflow) Children(step string) []string {
+	var res []string
+	for _, name := range w.names() {
+		if slices.Contains(w.Steps[name].After, step) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// ForStep produces a copy of the workflow as it is carried by the task which
+// performs the named step.
+func (w *Workflow) ForStep(step string) *Workflow {
+	return &Workflow{
+		Id:    w.Id,
+		Step:  step,
+		Steps: w.Steps,
+	}
+}
+
+func (w *Workflow) Value() (driver.Value, error) {
+	if w == nil {
+		return nil, nil
+	} else {
+		return json.Marshal(w)
+	}
+}
+
+func (w *Workflow) Scan(src interface{}) error {
+	switch c := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(c, w)
+	case string:
+		return json.Unmarshal([]byte(c), w)
+	default:
+		return fmt.Errorf("Unsupported type: %T", src)
+	}
+}
@@ -3,6 +3,10 @@ package worklog
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/bww/go-ident/v1"
@@ -12,14 +16,152 @@ import (
 var (
 	ErrNotFound = errors.New("Not found")
 	ErrConflict = errors.New("Sequence conflict")
+	ErrResolved = errors.New("Entry is resolved")
+)
+
+const (
+	paramState       = "state"
+	paramExpired     = "expired"
+	paramResolved    = "resolved"
+	paramIdleSince   = "idle_since"
+	paramActiveSince = "active_since"
+	paramWorkflow    = "workflow"
+	paramKey         = "idempotency_key"
+	paramConcurrency = "concurrency_key"
+	paramLimit       = "limit"
 )
 
 type Criteria struct {
-	Expired     bool      // Expired...
-	Resolved    bool      // ... and Resolved are logically mutually exclusive
-	IdleSince   time.Time // Excludes entries that HAVE BEEN updated after this time
-	ActiveSince time.Time // Excludes entries that HAVE NOT BEEN updated since this time
-	States      []State   // Only include results in these states; mutually exclusive with Expired and Resolved
+	Expired        bool        // Expired...
+	Resolved       bool        // ... and Resolved are logically mutually exclusive
+	IdleSince      time.Time   // Excludes entries that HAVE BEEN updated after this time
+	ActiveSince    time.Time   // Excludes entries that HAVE NOT BEEN updated since this time
+	States         []State     // Only include results in these states; mutually exclusive with Resolved
+	Workflow       ident.Ident // Only include tasks which belong to this workflow
+	Key            string      // Only include tasks which were published with this idempotency key
+	ConcurrencyKey string      // Only include tasks which run under this concurrency key
+	Limit          int         // Only include up to this many results, oldest first; zero is unlimited
+}
+
+// CriteriaFromParams parses criteria from query parameters. States may be
+// repeated and times are expected in RFC 3339 format.
+func CriteriaFromParams(params url.Values) (Criteria, error) {
+	var (
+		c   Criteria
+		err error
+	)
+	for _, e := range params[paramState] {
+		s, err := ParseState(e)
+		if err != nil {
+			return c, fmt.Errorf("%w: %s", err, e)
+		}
+		c.States = append(c.States, s)
+	}
+	if v := params.Get(paramExpired); v != "" {
+		c.Expired, err = strconv.ParseBool(v)
+		if err != nil {
+			return c, err
+		}
+	}
+	if v := params.Get(paramResolved); v != "" {
+		c.Resolved, err = strconv.ParseBool(v)
+		if err != nil {
+			return c, err
+		}
+	}
+	if v := params.Get(paramIdleSince); v != "" {
+		c.IdleSince, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return c, err
+		}
+	}
+	if v := params.Get(paramActiveSince); v != "" {
+		c.ActiveSince, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return c, err
+		}
+	}
+	if v := params.Get(paramWorkflow); v != "" {
+		c.Workflow, err = ident.Parse(v)
+		if err != nil {
+			return c, err
+		}
+	}
+	if v := params.Get(paramLimit); v != "" {
+		c.Limit, err = strconv.Atoi(v)
+		if err != nil {
+			return c, err
+		} else if c.Limit < 0 {
+			return c, fmt.Errorf("Invalid limit: %d", c.Limit)
+		}
+	}
+	c.Key = params.Get(paramKey)
+	c.ConcurrencyKey = params.Get(paramConcurrency)
+	return c, nil
+}
+
+func (c Criteria) Params() url.Values {
+	params := make(url.Values)
+	for _, e := range c.States {
+		params.Add(paramState, e.String())
+	}
+	if c.Expired {
+		params.Set(paramExpired, "true")
+	}
+	if c.Resolved {
+		params.Set(paramResolved, "true")
+	}
+	if !c.IdleSince.IsZero() {
+		params.Set(paramIdleSince, c.IdleSince.Format(time.RFC3339Nano))
+	}
+	if !c.ActiveSince.IsZero() {
+		params.Set(paramActiveSince, c.ActiveSince.Format(time.RFC3339Nano))
+	}
+	if c.Workflow != ident.Zero {
+		params.Set(paramWorkflow, c.Workflow.String())
+	}
+	if c.Key != "" {
+		params.Set(paramKey, c.Key)
+	}
+	if c.ConcurrencyKey != "" {
+		params.Set(paramConcurrency, c.ConcurrencyKey)
+	}
+	if c.Limit > 0 {
+		params.Set(paramLimit, strconv.Itoa(c.Limit))
+	}
+	return params
+}
+
+// Matches determines if the provided entry satisfies the criteria as of the
+// time when. Backends which cannot express the criteria natively in their
+// query language may use this to filter results. The limit is not considered;
+// it applies to the results as a whole.
+func (c Criteria) Matches(ent *Entry, when time.Time) bool {
+	if c.Expired && ent.Valid(when) {
+		return false
+	}
+	if c.Resolved && !ent.Resolved() {
+		return false
+	}
+	if !c.IdleSince.IsZero() && ent.Created.After(c.IdleSince) {
+		return false
+	}
+	if !c.ActiveSince.IsZero() && ent.Created.Before(c.ActiveSince) {
+		return false
+	}
+	if len(c.States) > 0 && !slices.Contains(c.States, ent.State) {
+		return false
+	}
+	if c.Workflow != ident.Zero && ent.WorkflowId() != c.Workflow {
+		return false
+	}
+	if c.Key != "" && ent.IdempotencyKey() != c.Key {
+		return false
+	}
+	if c.ConcurrencyKey != "" && ent.ConcurrencyKey() != c.ConcurrencyKey {
+		return false
+	}
+	return true
 }
 
 type Worklog interface {
@@ -33,3 +175,42 @@ type Worklog interface {
 
 	DeleteEveryEntryForTask(context.Context, ident.Ident) error
 }
+
+// HistoryWorklog is implemented by worklogs which can efficiently fetch the
+// entire log for a task at once.
+type HistoryWorklog interface {
+	Worklog
+	FetchEveryEntryForTask(context.Context, ident.Ident) ([]*Entry, error)
+}
+
+// FetchHistory obtains every entry for a task, in sequence order. If the
+// worklog implements HistoryWorklog it is used directly, otherwise every
+// sequence up to the latest is fetched individually. If the task does not
+// exist, ErrNotFound is returned.
+func FetchHistory(cxt context.Context, wl Worklog, id ident.Ident) ([]*Entry, error) {
+	if h, ok := wl.(HistoryWorklog); ok {
+		res, err := h.FetchEveryEntryForTask(cxt, id)
+		if err != nil {
+			return nil, err
+		} else if len(res) < 1 {
+			return nil, ErrNotFound
+		}
+		return res, nil
+	}
+
+	lst, err := wl.FetchLatestEntryForTask(cxt, id)
+	if err != nil {
+		return nil, err
+	}
+	var res []*Entry
+	for i := int64(0); i < lst.TaskSeq; i++ {
+		ent, err := wl.FetchEntry(cxt, id, i)
+		if errors.Is(err, ErrNotFound) {
+			continue // sequences need not be contiguous
+		} else if err != nil {
+			return nil, err
+		}
+		res = append(res, ent)
+	}
+	return append(res, lst), nil
+}
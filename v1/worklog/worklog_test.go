@@ -0,0 +1,62 @@
+package worklog
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bww/go-ident/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCriteriaParams(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tests := []Criteria{
+		{},
+		{States: []State{Pending, Running}},
+		{Expired: true, IdleSince: now},
+		{Resolved: true, ActiveSince: now},
+		{Workflow: ident.New()},
+		{Key: "abc"},
+		{ConcurrencyKey: "test://a"},
+		{States: []State{Pending}, Limit: 10},
+	}
+	for _, e := range tests {
+		c, err := CriteriaFromParams(e.Params())
+		if assert.NoError(t, err) {
+			assert.True(t, e.IdleSince.Equal(c.IdleSince))
+			assert.True(t, e.ActiveSince.Equal(c.ActiveSince))
+			c.IdleSince, c.ActiveSince = e.IdleSince, e.ActiveSince
+			assert.Equal(t, e, c)
+		}
+	}
+
+	_, err := CriteriaFromParams(url.Values{"state": {"bogus"}})
+	assert.Error(t, err)
+	_, err = CriteriaFromParams(url.Values{"idle_since": {"yesterday"}})
+	assert.Error(t, err)
+	_, err = CriteriaFromParams(url.Values{"limit": {"-1"}})
+	assert.Error(t, err)
+}
+
+func TestWorkflow(t *testing.T) {
+	wf := NewWorkflow().
+		AddStep("a", "test://a", nil).
+		AddStep("b", "test://b", nil, "a").
+		AddStep("c", "test://c", nil, "a").
+		AddStep("d", "test://d", nil, "b", "c")
+	assert.NoError(t, wf.Validate())
+	assert.Equal(t, []string{"a"}, wf.Roots())
+	assert.Equal(t, []string{"b", "c"}, wf.Children("a"))
+	assert.Equal(t, []string{"d"}, wf.Children("b"))
+	assert.Nil(t, wf.Children("d"))
+
+	assert.ErrorIs(t, NewWorkflow().Validate(), ErrInvalidWorkflow)
+	assert.ErrorIs(t, NewWorkflow().AddStep("a", "", nil).Validate(), ErrInvalidWorkflow)
+	assert.ErrorIs(t, NewWorkflow().AddStep("a", "test://a", nil, "z").Validate(), ErrInvalidWorkflow)
+	assert.ErrorIs(t, NewWorkflow().
+		AddStep("a", "test://a", nil, "c").
+		AddStep("b", "test://b", nil, "a").
+		AddStep("c", "test://c", nil, "b").
+		Validate(), ErrCyclicWorkflow)
+}
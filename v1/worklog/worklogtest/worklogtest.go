@@ -0,0 +1,369 @@
+// Package worklogtest provides a conformance suite which every implementation
+// of the worklog is expected to pass. Implementations run it from their own
+// tests, for example:
+//
+//	func TestConformance(t *testing.T) {
+//		worklogtest.Run(t, func(t *testing.T) worklog.Worklog {
+//			return memory.New()
+//		})
+//	}
+package worklogtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bww/go-tasks/v1/attrs"
+	"github.com/bww/go-tasks/v1/worklog"
+
+	"github.com/bww/go-ident/v1"
+	siter "github.com/bww/go-iterator/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory produces a worklog for an individual test case. The worklog need
+// not be empty; the suite only considers tasks it creates itself, so a
+// factory may return the same worklog for every case.
+type Factory func(*testing.T) worklog.Worklog
+
+type testCase struct {
+	name string
+	fn   func(*testing.T, context.Context, worklog.Worklog)
+}
+
+var cases = []testCase{
+	{"CreateEntry", testCreateEntry},
+	{"StoreEntry", testStoreEntry},
+	{"Ordering", testOrdering},
+	{"RoundTrip", testRoundTrip},
+	{"RenewEntry", testRenewEntry},
+	{"Expiry", testExpiry},
+	{"Criteria", testCriteria},
+	{"DeleteEveryEntryForTask", testDeleteEveryEntryForTask},
+	{"History", testHistory},
+}
+
+// Run executes the conformance suite against worklogs produced by the
+// provided factory.
+func Run(t *testing.T, factory Factory) {
+	for _, e := range cases {
+		t.Run(e.name, func(t *testing.T) {
+			e.fn(t, context.Background(), factory(t))
+		})
+	}
+}
+
+// the reference time for tests; backends are not expected to retain more
+// than microsecond precision
+func reference() time.Time {
+	return time.Now().Truncate(time.Millisecond)
+}
+
+func newEntry(state worklog.State, created time.Time) *worklog.Entry {
+	return &worklog.Entry{
+		TaskId:  ident.New(),
+		State:   state,
+		UTD:     "test://worklog/" + string(state),
+		Created: created,
+	}
+}
+
+func next(ent *worklog.Entry, state worklog.State, created time.Time) *worklog.Entry {
+	return ent.Next(state, nil).SetCreated(created)
+}
+
+func testCreateEntry(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := newEntry(worklog.Pending, now)
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+
+	// creating any entry for a task which already exists is a conflict,
+	// regardless of its sequence
+	assert.ErrorIs(t, wl.CreateEntry(cxt, ent), worklog.ErrConflict)
+	assert.ErrorIs(t, wl.CreateEntry(cxt, next(ent, worklog.Running, now)), worklog.ErrConflict)
+
+	lst, err := wl.FetchLatestEntryForTask(cxt, ent.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ent.TaskSeq, lst.TaskSeq)
+		assert.Equal(t, worklog.Pending, lst.State)
+	}
+}
+
+func testStoreEntry(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+
+	// storing the first entry for a task which does not exist is permitted
+	ent := newEntry(worklog.Running, now)
+	assert.NoError(t, wl.StoreEntry(cxt, ent))
+
+	run := next(ent, worklog.Running, now)
+	assert.NoError(t, wl.StoreEntry(cxt, run))
+	// the same sequence cannot be stored twice...
+	assert.ErrorIs(t, wl.StoreEntry(cxt, run), worklog.ErrConflict)
+	// ...nor can a stale sequence
+	assert.ErrorIs(t, wl.StoreEntry(cxt, ent), worklog.ErrConflict)
+
+	// sequences need not be contiguous, only increasing
+	skip := next(run, worklog.Complete, now).SetTaskSeq(run.TaskSeq + 10)
+	assert.NoError(t, wl.StoreEntry(cxt, skip))
+	assert.ErrorIs(t, wl.StoreEntry(cxt, next(run, worklog.Failed, now)), worklog.ErrConflict)
+}
+
+func testOrdering(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := newEntry(worklog.Pending, now)
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+	run := next(ent, worklog.Running, now.Add(time.Second))
+	assert.NoError(t, wl.StoreEntry(cxt, run))
+	done := next(run, worklog.Complete, now.Add(time.Second*2))
+	assert.NoError(t, wl.StoreEntry(cxt, done))
+
+	lst, err := wl.FetchLatestEntryForTask(cxt, ent.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, done.TaskSeq, lst.TaskSeq)
+		assert.Equal(t, worklog.Complete, lst.State)
+	}
+	for _, e := range []*worklog.Entry{ent, run, done} {
+		v, err := wl.FetchEntry(cxt, e.TaskId, e.TaskSeq)
+		if assert.NoError(t, err) {
+			assert.Equal(t, e.State, v.State)
+			assert.True(t, e.Created.Equal(v.Created), "%v != %v", e.Created, v.Created)
+		}
+	}
+
+	_, err = wl.FetchEntry(cxt, ent.TaskId, done.TaskSeq+1)
+	assert.ErrorIs(t, err, worklog.ErrNotFound)
+	_, err = wl.FetchLatestEntryForTask(cxt, ident.New())
+	assert.ErrorIs(t, err, worklog.ErrNotFound)
+}
+
+func testRoundTrip(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := &worklog.Entry{
+		TaskId:   ident.New(),
+		TaskSeq:  3,
+		State:    worklog.Failed,
+		StateSeq: 2,
+		UTD:      "test://worklog/roundtrip?a=b",
+		Data:     []byte{0, 1, 2, 0xff},
+		Attrs:    attrs.Attributes{"retries": "2"},
+		Error:    []byte(`{"message":"Oops"}`),
+		Triggers: worklog.Triggers{worklog.Complete: {"test://a", "test://b"}},
+		Workflow: worklog.NewWorkflow().AddStep("a", "test://a", nil).AddStep("b", "test://b", []byte("b"), "a").ForStep("a"),
+		Retry:    true,
+		Created:  now,
+	}
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+
+	v, err := wl.FetchLatestEntryForTask(cxt, ent.TaskId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ent.TaskId, v.TaskId)
+		assert.Equal(t, ent.TaskSeq, v.TaskSeq)
+		assert.Equal(t, ent.State, v.State)
+		assert.Equal(t, ent.StateSeq, v.StateSeq)
+		assert.Equal(t, ent.UTD, v.UTD)
+		assert.Equal(t, ent.Data, v.Data)
+		assert.Equal(t, ent.Attrs, v.Attrs)
+		assert.JSONEq(t, string(ent.Error), string(v.Error))
+		assert.Equal(t, ent.Triggers, v.Triggers)
+		assert.Equal(t, ent.Workflow, v.Workflow)
+		assert.Equal(t, ent.Retry, v.Retry)
+		assert.True(t, ent.Created.Equal(v.Created))
+		assert.Nil(t, v.Expires)
+	}
+}
+
+func testRenewEntry(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := newEntry(worklog.Pending, now)
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+	run := next(ent, worklog.Running, now).SetExpires(now.Add(time.Minute))
+	assert.NoError(t, wl.StoreEntry(cxt, run))
+
+	// renewal updates the current entry in place; it does not advance the
+	// sequence
+	ren, err := wl.RenewEntry(cxt, run, now.Add(time.Hour))
+	if assert.NoError(t, err) && assert.NotNil(t, ren.Expires) {
+		assert.Equal(t, run.TaskSeq, ren.TaskSeq)
+		assert.True(t, now.Add(time.Hour).Equal(*ren.Expires))
+	}
+	lst, err := wl.FetchLatestEntryForTask(cxt, ent.TaskId)
+	if assert.NoError(t, err) && assert.NotNil(t, lst.Expires) {
+		assert.Equal(t, run.TaskSeq, lst.TaskSeq)
+		assert.True(t, now.Add(time.Hour).Equal(*lst.Expires))
+	}
+
+	// a superseded entry cannot be renewed
+	_, err = wl.RenewEntry(cxt, ent, now.Add(time.Hour))
+	assert.ErrorIs(t, err, worklog.ErrConflict)
+	// nor can one which doesn't exist
+	_, err = wl.RenewEntry(cxt, newEntry(worklog.Running, now), now.Add(time.Hour))
+	assert.ErrorIs(t, err, worklog.ErrNotFound)
+
+	// a resolved entry cannot be renewed
+	done := next(run, worklog.Complete, now)
+	assert.NoError(t, wl.StoreEntry(cxt, done))
+	_, err = wl.RenewEntry(cxt, done, now.Add(time.Hour))
+	assert.ErrorIs(t, err, worklog.ErrResolved)
+}
+
+func testExpiry(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := newEntry(worklog.Running, now).SetExpires(now.Add(time.Minute))
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+
+	expired := func(when time.Time) bool {
+		ids, err := collect(wl, cxt, worklog.Criteria{Expired: true}, when, ent)
+		assert.NoError(t, err)
+		return len(ids) > 0
+	}
+
+	assert.False(t, expired(now))
+	assert.True(t, expired(now.Add(time.Minute))) // expiration is inclusive
+	assert.True(t, expired(now.Add(time.Hour)))
+
+	_, err := wl.RenewEntry(cxt, ent, now.Add(time.Hour*2))
+	assert.NoError(t, err)
+	assert.False(t, expired(now.Add(time.Hour)))
+
+	// resolved entries never expire
+	done := next(ent, worklog.Complete, now).SetExpires(now)
+	assert.NoError(t, wl.StoreEntry(cxt, done))
+	assert.False(t, expired(now.Add(time.Hour*3)))
+}
+
+func testCriteria(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+
+	pending := newEntry(worklog.Pending, now.Add(-time.Hour))
+	expired := newEntry(worklog.Running, now.Add(-time.Minute*30)).SetExpires(now.Add(-time.Minute))
+	running := newEntry(worklog.Running, now.Add(-time.Minute*10)).SetExpires(now.Add(time.Minute))
+	failed := newEntry(worklog.Failed, now.Add(-time.Minute*5))
+	complete := newEntry(worklog.Pending, now.Add(-time.Minute*50))
+	wf := &worklog.Workflow{Id: ident.New()}
+	running.SetWorkflow(wf)
+	failed.SetWorkflow(wf)
+	pending.SetAttrs(attrs.Attributes{worklog.AttrIdempotencyKey: "abc"})
+	complete.SetAttrs(attrs.Attributes{worklog.AttrIdempotencyKey: "abc"})
+	expired.SetAttrs(attrs.Attributes{worklog.AttrConcurrencyKey: "test://a"})
+	running.SetAttrs(attrs.Attributes{worklog.AttrConcurrencyKey: "test://a"})
+	all := []*worklog.Entry{pending, expired, running, failed, complete}
+	for _, e := range all {
+		assert.NoError(t, wl.CreateEntry(cxt, e))
+	}
+	// only the latest entry for a task is considered
+	assert.NoError(t, wl.StoreEntry(cxt, next(complete, worklog.Complete, now)))
+
+	tests := []struct {
+		name   string
+		crit   worklog.Criteria
+		expect []*worklog.Entry
+	}{
+		{"Everything", worklog.Criteria{}, []*worklog.Entry{pending, expired, running, failed, complete}},
+		{"Expired", worklog.Criteria{Expired: true}, []*worklog.Entry{expired}},
+		{"Resolved", worklog.Criteria{Resolved: true}, []*worklog.Entry{failed, complete}},
+		{"States", worklog.Criteria{States: []worklog.State{worklog.Pending, worklog.Running}}, []*worklog.Entry{pending, expired, running}},
+		{"IdleSince", worklog.Criteria{IdleSince: now.Add(-time.Minute * 20)}, []*worklog.Entry{pending, expired}},
+		{"ActiveSince", worklog.Criteria{ActiveSince: now.Add(-time.Minute * 20)}, []*worklog.Entry{running, failed, complete}},
+		{"IdleAndActive", worklog.Criteria{ActiveSince: now.Add(-time.Minute * 45), IdleSince: now.Add(-time.Minute * 8)}, []*worklog.Entry{expired, running}},
+		{"StatesAndActive", worklog.Criteria{States: []worklog.State{worklog.Running}, ActiveSince: now.Add(-time.Minute * 20)}, []*worklog.Entry{running}},
+		{"ResolvedAndIdle", worklog.Criteria{Resolved: true, IdleSince: now.Add(-time.Minute)}, []*worklog.Entry{failed}},
+		{"ExpiredAndStates", worklog.Criteria{Expired: true, States: []worklog.State{worklog.Running}}, []*worklog.Entry{expired}},
+		{"ExpiredAndOtherStates", worklog.Criteria{Expired: true, States: []worklog.State{worklog.Pending}}, nil},
+		{"ExpiredAndIdle", worklog.Criteria{Expired: true, IdleSince: now.Add(-time.Minute * 40)}, nil},
+		{"Workflow", worklog.Criteria{Workflow: wf.Id}, []*worklog.Entry{running, failed}},
+		{"WorkflowAndStates", worklog.Criteria{Workflow: wf.Id, States: []worklog.State{worklog.Failed}}, []*worklog.Entry{failed}},
+		{"WorkflowAndLimit", worklog.Criteria{Workflow: wf.Id, Limit: 1}, []*worklog.Entry{running}},
+		{"Key", worklog.Criteria{Key: "abc"}, []*worklog.Entry{pending, complete}},
+		{"KeyAndStates", worklog.Criteria{Key: "abc", States: []worklog.State{worklog.Pending, worklog.Running}}, []*worklog.Entry{pending}},
+		{"ConcurrencyKey", worklog.Criteria{ConcurrencyKey: "test://a"}, []*worklog.Entry{expired, running}},
+		{"ConcurrencyKeyAndExpired", worklog.Criteria{ConcurrencyKey: "test://a", Expired: true}, []*worklog.Entry{expired}},
+		{"NoMatch", worklog.Criteria{States: []worklog.State{worklog.Canceled}}, nil},
+	}
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			res, err := collect(wl, cxt, e.crit, now, all...)
+			if assert.NoError(t, err) {
+				var ids []ident.Ident
+				for _, x := range e.expect {
+					ids = append(ids, x.TaskId)
+				}
+				assert.Equal(t, ids, res) // results are ordered by creation, oldest first
+			}
+		})
+	}
+}
+
+func testDeleteEveryEntryForTask(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := newEntry(worklog.Pending, now)
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+	assert.NoError(t, wl.StoreEntry(cxt, next(ent, worklog.Running, now)))
+	other := newEntry(worklog.Pending, now)
+	assert.NoError(t, wl.CreateEntry(cxt, other))
+
+	assert.NoError(t, wl.DeleteEveryEntryForTask(cxt, ent.TaskId))
+	_, err := wl.FetchLatestEntryForTask(cxt, ent.TaskId)
+	assert.ErrorIs(t, err, worklog.ErrNotFound)
+	_, err = wl.FetchEntry(cxt, ent.TaskId, ent.TaskSeq)
+	assert.ErrorIs(t, err, worklog.ErrNotFound)
+
+	// other tasks are unaffected
+	_, err = wl.FetchLatestEntryForTask(cxt, other.TaskId)
+	assert.NoError(t, err)
+
+	// a deleted task may be created again
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+	// and deleting a task which doesn't exist is not an error
+	assert.NoError(t, wl.DeleteEveryEntryForTask(cxt, ident.New()))
+}
+
+// basic hides any optional interfaces implemented by a worklog
+type basic struct {
+	worklog.Worklog
+}
+
+func testHistory(t *testing.T, cxt context.Context, wl worklog.Worklog) {
+	now := reference()
+	ent := newEntry(worklog.Pending, now)
+	assert.NoError(t, wl.CreateEntry(cxt, ent))
+	run := next(ent, worklog.Running, now)
+	assert.NoError(t, wl.StoreEntry(cxt, run))
+	done := next(run, worklog.Complete, now).SetTaskSeq(run.TaskSeq + 5)
+	assert.NoError(t, wl.StoreEntry(cxt, done))
+
+	// the history is the same whether or not the worklog can fetch it directly
+	for _, e := range []worklog.Worklog{wl, basic{wl}} {
+		res, err := worklog.FetchHistory(cxt, e, ent.TaskId)
+		if assert.NoError(t, err) && assert.Len(t, res, 3) {
+			assert.Equal(t, []int64{ent.TaskSeq, run.TaskSeq, done.TaskSeq}, []int64{res[0].TaskSeq, res[1].TaskSeq, res[2].TaskSeq})
+			assert.Equal(t, []worklog.State{worklog.Pending, worklog.Running, worklog.Complete}, []worklog.State{res[0].State, res[1].State, res[2].State})
+		}
+		_, err = worklog.FetchHistory(cxt, e, ident.New())
+		assert.ErrorIs(t, err, worklog.ErrNotFound)
+	}
+}
+
+// collect iterates the latest entry for every task which matches the criteria
+// and produces the identifiers of those which belong to the provided set of
+// entries, in the order they were returned.
+func collect(wl worklog.Worklog, cxt context.Context, crit worklog.Criteria, when time.Time, among ...*worklog.Entry) ([]ident.Ident, error) {
+	known := make(map[ident.Ident]struct{})
+	for _, e := range among {
+		known[e.TaskId] = struct{}{}
+	}
+	it, err := wl.IterLatestEntryForEveryTask(cxt, crit, when)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var res []ident.Ident
+	err = siter.Visit(it, siter.VisitorFunc[*worklog.Entry](func(e *worklog.Entry) error {
+		if _, ok := known[e.TaskId]; ok {
+			res = append(res, e.TaskId)
+		}
+		return nil
+	}))
+	return res, err
+}